@@ -0,0 +1,225 @@
+package ddbmodel
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxBatchGetKeys = 100
+
+	DefaultBatchConcurrency = 4
+)
+
+// BatchGetKeys reads the items with the given keys into itemList and returns
+// the keys that have no item. A key maps every key attribute of the table,
+// or of its hash and range key, to a value.
+//
+// Keys are read 100 per BatchGetItem call, Concurrency calls at a time, and
+// keys DynamoDB leaves unprocessed are retried with backoff. Items are in
+// the order of keys if Ordered is set, else in the order they arrive.
+func (w *Worker) BatchGetKeys(keys []map[string]interface{}, itemList interface{}) ([]map[string]interface{}, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var keyNames []string
+	for name := range keys[0] {
+		keyNames = append(keyNames, name)
+	}
+	sort.Strings(keyNames)
+
+	// DynamoDB rejects duplicate keys, so each distinct key is read once.
+	keyStrings := make([]string, len(keys))
+	var unique []map[string]*dynamodb.AttributeValue
+	seen := make(map[string]bool, len(keys))
+	for i, k := range keys {
+		av, err := dynamodbattribute.MarshalMap(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "MarshalMap error")
+		}
+		keyStrings[i] = batchKeyString(keyNames, av)
+		if !seen[keyStrings[i]] {
+			seen[keyStrings[i]] = true
+			unique = append(unique, av)
+		}
+	}
+
+	template := &dynamodb.KeysAndAttributes{
+		ConsistentRead: aws.Bool(w.IsConsistentRead),
+	}
+	if len(w.ProjectionAttrs) > 0 {
+		// Key attributes are always projected so that items can be matched
+		// back to their keys.
+		attrs := append([]string(nil), w.ProjectionAttrs...)
+		for _, name := range keyNames {
+			if !containsString(attrs, name) {
+				attrs = append(attrs, name)
+			}
+		}
+		expAttrNames := make([]string, len(attrs))
+		expAttrNameMap := make(map[string]*string, len(attrs))
+		for i, name := range attrs {
+			aliasName := fmt.Sprintf("#EAN%d", i)
+			expAttrNames[i] = aliasName
+			expAttrNameMap[aliasName] = aws.String(name)
+		}
+		template.SetExpressionAttributeNames(expAttrNameMap)
+		template.SetProjectionExpression(strings.Join(expAttrNames, ","))
+	}
+
+	ctx, cancel := context.WithCancel(w.requestContext())
+	defer cancel()
+	client := newDynamoDB(w.AwsSession)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		arrived  []map[string]*dynamodb.AttributeValue
+		firstErr error
+		sem      = make(chan struct{}, w.concurrency())
+	)
+	for start := 0; start < len(unique) && ctx.Err() == nil; start += maxBatchGetKeys {
+		end := start + maxBatchGetKeys
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(chunk []map[string]*dynamodb.AttributeValue) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			items, err := w.getChunk(ctx, client, template, chunk)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			arrived = append(arrived, items...)
+		}(unique[start:end])
+	}
+	wg.Wait()
+	if firstErr == nil && ctx.Err() != nil {
+		// The context ended before every chunk was read, without any chunk
+		// failing.
+		firstErr = errors.Wrap(ctx.Err(), "dynamodb BatchGetItem failed")
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	found := make(map[string]map[string]*dynamodb.AttributeValue, len(arrived))
+	for _, item := range arrived {
+		found[batchKeyString(keyNames, item)] = item
+	}
+
+	values := arrived
+	if w.KeepOrder {
+		values = make([]map[string]*dynamodb.AttributeValue, 0, len(arrived))
+	}
+	var missing []map[string]interface{}
+	for i, ks := range keyStrings {
+		item, ok := found[ks]
+		if !ok {
+			missing = append(missing, keys[i])
+		} else if w.KeepOrder {
+			values = append(values, item)
+		}
+	}
+
+	err := dynamodbattribute.UnmarshalListOfMaps(values, itemList)
+	if err != nil {
+		return nil, errors.Wrap(err, "UnmarshalListOfMaps failed")
+	}
+	return missing, nil
+}
+
+// getChunk reads up to 100 keys, retrying unprocessed keys with backoff.
+func (w *Worker) getChunk(ctx context.Context, client *dynamodb.DynamoDB, template *dynamodb.KeysAndAttributes, pending []map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, error) {
+	var items []map[string]*dynamodb.AttributeValue
+	for attempt := 0; ; attempt++ {
+		keysAndAttrs := *template
+		keysAndAttrs.Keys = pending
+
+		output, err := client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				w.TableName: &keysAndAttrs,
+			},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return nil, errors.Wrap(classifyError(err), "dynamodb BatchGetItem failed")
+		}
+		items = append(items, output.Responses[w.TableName]...)
+
+		unprocessed, ok := output.UnprocessedKeys[w.TableName]
+		if !ok || len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+		pending = unprocessed.Keys
+		if err := w.backoff().Wait(ctx, attempt); err != nil {
+			return nil, errors.Wrap(err, "retry unprocessed keys failed")
+		}
+	}
+}
+
+func (w *Worker) concurrency() int {
+	if w.BatchConcurrency <= 0 {
+		return DefaultBatchConcurrency
+	}
+	return w.BatchConcurrency
+}
+
+// batchKeyString identifies an item by its key attributes. Numbers are
+// compared by value, as DynamoDB may not return them as they were sent.
+func batchKeyString(keyNames []string, item map[string]*dynamodb.AttributeValue) string {
+	var b strings.Builder
+	for _, name := range keyNames {
+		av := item[name]
+		switch {
+		case av == nil:
+		case av.S != nil:
+			b.WriteString("S" + strconv.Quote(*av.S))
+		case av.N != nil:
+			n := *av.N
+			if r, ok := new(big.Rat).SetString(n); ok {
+				n = r.RatString()
+			}
+			b.WriteString("N" + n)
+		case av.B != nil:
+			b.WriteString("B" + strconv.Quote(string(av.B)))
+		}
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package ddbmodel
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// newDynamoDB creates a DynamoDB client for sess. When the session has no
+// endpoint of its own, AWS_ENDPOINT_URL_DYNAMODB or AWS_ENDPOINT_URL point
+// the client elsewhere, as the v2 SDK does, e.g. at a local cmd/ddblocal.
+func newDynamoDB(sess *session.Session) *dynamodb.DynamoDB {
+	if aws.StringValue(sess.Config.Endpoint) == "" {
+		for _, env := range []string{"AWS_ENDPOINT_URL_DYNAMODB", "AWS_ENDPOINT_URL"} {
+			if endpoint := os.Getenv(env); endpoint != "" {
+				return dynamodb.New(sess, aws.NewConfig().WithEndpoint(endpoint))
+			}
+		}
+	}
+	return dynamodb.New(sess)
+}
@@ -0,0 +1,44 @@
+// Command ddblocal runs a local stand-in for DynamoDB.
+//
+// It speaks the DynamoDB JSON 1.0 protocol, keeping tables in memory or,
+// with -file, in a JSON file that survives restarts. Point both SDK
+// generations at it with:
+//
+//	export AWS_ENDPOINT_URL_DYNAMODB=http://localhost:8000
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/thisissc/ddbmodel/ddbmodeltest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8000", "address to listen on")
+	file := flag.String("file", "", "file to keep tables in; in memory when empty")
+	flag.Parse()
+
+	db := ddbmodeltest.New()
+	if *file != "" {
+		var err error
+		db, err = ddbmodeltest.Open(*file)
+		if err != nil {
+			log.Fatalf("failed to open %s, %v", *file, err)
+		}
+	}
+
+	srv, err := ddbmodeltest.NewServer(db, *addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s, %v", *addr, err)
+	}
+	log.Printf("serving DynamoDB on %s", srv.URL)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	srv.Close()
+}
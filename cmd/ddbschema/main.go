@@ -0,0 +1,21 @@
+// Command ddbschema is an example of a schema tool built on
+// ddbmodel.RunSchemaCommand:
+//
+//	ddbschema check [-table name,...]
+//	ddbschema ensure [-table name,...]
+//
+// It acts on the tables that uglymodel registers. A service builds its own
+// tool the same way, importing its model packages instead of uglymodel;
+// see RunSchemaCommand for the commands.
+package main
+
+import (
+	"os"
+
+	"github.com/thisissc/ddbmodel"
+	_ "github.com/thisissc/ddbmodel/uglymodel"
+)
+
+func main() {
+	os.Exit(ddbmodel.RunSchemaCommand(os.Args[1:]))
+}
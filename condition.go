@@ -0,0 +1,104 @@
+package ddbmodel
+
+import (
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/pkg/errors"
+)
+
+// When makes Update, Incr, Add2Set, RemoveAttribute, BatchUpdate,
+// UpdateByExpression and Delete apply only if the stored item satisfies
+// cond, and fail with a ConditionFailedError otherwise. Conditions of
+// several calls, and one set on the expression of UpdateByExpression, must
+// all hold.
+func (w *Worker) When(cond expression.ConditionBuilder) *Worker {
+	w.WriteConds = append(w.WriteConds, cond)
+	return w
+}
+
+// placeholderPattern matches the placeholders the expression package
+// generates, such as #0 and :0.
+var placeholderPattern = regexp.MustCompile(`([#:])([0-9]+)`)
+
+// conditionInput is the condition part of a write input.
+type conditionInput struct {
+	expr   *string
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+}
+
+// addWhen ANDs the When conditions into in. They are built on their own
+// and their placeholders renamed, so that they cannot collide with those of
+// an expression built elsewhere.
+func (w *Worker) addWhen(in *conditionInput) error {
+	if len(w.WriteConds) == 0 {
+		return nil
+	}
+
+	cond := w.WriteConds[0]
+	if len(w.WriteConds) > 1 {
+		cond = expression.And(w.WriteConds[0], w.WriteConds[1], w.WriteConds[2:]...)
+	}
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return errors.Wrap(err, "Build expression error")
+	}
+
+	// The maps of in may be those of an expression the caller reuses, so
+	// the placeholders go into copies. DynamoDB rejects empty maps, so they
+	// are only made when needed.
+	names, values := copyNames(in.names), copyValues(in.values)
+	for k, v := range expr.Names() {
+		if names == nil {
+			names = make(map[string]*string)
+		}
+		names[renamePlaceholders(k)] = v
+	}
+	for k, v := range expr.Values() {
+		if values == nil {
+			values = make(map[string]*dynamodb.AttributeValue)
+		}
+		values[renamePlaceholders(k)] = v
+	}
+	in.names, in.values = names, values
+
+	when := renamePlaceholders(aws.StringValue(expr.Condition()))
+	if in.expr != nil {
+		when = "(" + *in.expr + ") AND (" + when + ")"
+	}
+	in.expr = aws.String(when)
+	return nil
+}
+
+func renamePlaceholders(s string) string {
+	return placeholderPattern.ReplaceAllString(s, "${1}when$2")
+}
+
+// copyNames returns a copy of the expression attribute names m, nil when
+// it is empty.
+func copyNames(m map[string]*string) map[string]*string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]*string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// copyValues returns a copy of the expression attribute values m, nil when
+// it is empty.
+func copyValues(m map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]*dynamodb.AttributeValue, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,20 @@
+package ddbmodeltest
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/thisissc/ddbmodel/internal/memdb"
+)
+
+// Session returns an AWS session whose DynamoDB requests are served by db.
+// SDK retries are disabled so that tests observe every error directly.
+func (db *DB) Session() *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(memdb.Region),
+		Endpoint:    aws.String("http://ddbmodeltest.local"),
+		Credentials: credentials.NewStaticCredentials("ddbmodeltest", "ddbmodeltest", ""),
+		HTTPClient:  db.HTTPClient(),
+		MaxRetries:  aws.Int(0),
+	}))
+}
@@ -1,8 +1,195 @@
 package ddbmodel
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+// The errors of the package are classified by these, which errors.Is
+// matches through any wrapping. errors.As still finds the SDK error that
+// caused them.
+var (
+	// ErrNotFound is an item that does not exist.
+	ErrNotFound = errors.New("item not found")
+	// ErrConditionFailed is a write whose condition did not hold.
+	ErrConditionFailed = errors.New("condition check failed")
+	// ErrThrottled is a request DynamoDB rejected for exceeding throughput
+	// or request limits.
+	ErrThrottled = errors.New("request throttled")
+	// ErrTransactionCanceled is a transaction DynamoDB canceled.
+	ErrTransactionCanceled = errors.New("transaction canceled")
+	// ErrValidation is a request DynamoDB rejected as invalid.
+	ErrValidation = errors.New("validation failed")
+	// ErrItemTooLarge is an item over the 400 KB limit, or an item
+	// collection over its 10 GB limit. It also matches ErrValidation.
+	ErrItemTooLarge = errors.New("item too large")
+)
+
 type DdbModelEmptyError struct{}
 
 func (e *DdbModelEmptyError) Error() string {
 	return "Empty DdbModel"
 }
 
+func (e *DdbModelEmptyError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// RequestError is an error DynamoDB returned, classified by Kind, one of
+// ErrThrottled, ErrValidation and ErrItemTooLarge.
+type RequestError struct {
+	Kind error
+	// Code is the AWS error code, empty when the request was refused
+	// before it was sent.
+	Code  string
+	Cause error
+}
+
+func (e *RequestError) Error() string {
+	return e.Kind.Error() + ": " + e.Cause.Error()
+}
+
+func (e *RequestError) Is(target error) bool {
+	return target == e.Kind || e.Kind == ErrItemTooLarge && target == ErrValidation
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Cause
+}
+
+// ConditionFailedError is returned when DynamoDB rejects a write because
+// its condition did not hold.
+type ConditionFailedError struct {
+	Cause error
+}
+
+func (e *ConditionFailedError) Error() string {
+	return "condition check failed: " + e.Cause.Error()
+}
+
+func (e *ConditionFailedError) Is(target error) bool {
+	return target == ErrConditionFailed
+}
+
+func (e *ConditionFailedError) Unwrap() error {
+	return e.Cause
+}
+
+// CancellationReason tells why DynamoDB canceled a transaction for one of
+// its items. Code is "None" for the items that were not at fault.
+type CancellationReason struct {
+	Code    string
+	Message string
+	// Item is the item as it was when its condition failed, if the action
+	// asked for it with ReturnValuesOnConditionCheckFailure.
+	Item map[string]*dynamodb.AttributeValue
+}
+
+// TransactionCanceledError is returned when DynamoDB cancels a transaction.
+// It also matches ErrConditionFailed if a condition of the transaction did
+// not hold.
+type TransactionCanceledError struct {
+	// Reasons are in the order of the items of the transaction.
+	Reasons []CancellationReason
+	Cause   error
+}
+
+func (e *TransactionCanceledError) Error() string {
+	return "transaction canceled: " + e.Cause.Error()
+}
+
+func (e *TransactionCanceledError) Is(target error) bool {
+	switch target {
+	case ErrTransactionCanceled:
+		return true
+	case ErrConditionFailed:
+		for _, r := range e.Reasons {
+			if r.Code == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *TransactionCanceledError) Unwrap() error {
+	return e.Cause
+}
+
+// classifyError turns the errors DynamoDB returns into the errors of the
+// package, and returns other errors as they are.
+func classifyError(err error) error {
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		reasons := make([]CancellationReason, len(canceled.CancellationReasons))
+		for i, r := range canceled.CancellationReasons {
+			reasons[i] = CancellationReason{Code: aws.StringValue(r.Code), Message: aws.StringValue(r.Message), Item: r.Item}
+		}
+		return &TransactionCanceledError{Reasons: reasons, Cause: err}
+	}
+
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+
+	var kind error
+	switch aerr.Code() {
+	case dynamodb.ErrCodeConditionalCheckFailedException:
+		return &ConditionFailedError{Cause: err}
+	case dynamodb.ErrCodeTransactionCanceledException:
+		return &TransactionCanceledError{Cause: err}
+	case dynamodb.ErrCodeProvisionedThroughputExceededException, dynamodb.ErrCodeRequestLimitExceeded, "ThrottlingException":
+		kind = ErrThrottled
+	case dynamodb.ErrCodeItemCollectionSizeLimitExceededException:
+		kind = ErrItemTooLarge
+	case "ValidationException":
+		kind = ErrValidation
+		if strings.Contains(aerr.Message(), "Item size") {
+			kind = ErrItemTooLarge
+		}
+	default:
+		return err
+	}
+	return &RequestError{Kind: kind, Code: aerr.Code(), Cause: err}
+}
+
+// ErrVersionConflict matches, through errors.Is, every error of a write
+// that lost an optimistic locking race.
+var ErrVersionConflict = errors.New("version conflict")
+
+// VersionConflictError is returned when a versioned write finds the stored
+// item at another version than the one loaded. It also matches
+// ErrConditionFailed.
+type VersionConflictError struct {
+	// Version is the version the write expected.
+	Version int64
+	Cause   error
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict: item is no longer at version %d", e.Version)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict || target == ErrConditionFailed
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return e.Cause
+}
+
+// versionConflict turns the condition failure of a write that expected
+// version into a VersionConflictError.
+func versionConflict(err error, version int64, message string) error {
+	var condErr *ConditionFailedError
+	if errors.As(err, &condErr) {
+		return errors.Wrap(&VersionConflictError{Version: version, Cause: condErr.Cause}, message)
+	}
+	return err
+}
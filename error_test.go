@@ -0,0 +1,169 @@
+package ddbmodel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/pkg/errors"
+)
+
+func TestClassifyError(t *testing.T) {
+	kinds := []error{ErrNotFound, ErrConditionFailed, ErrThrottled, ErrTransactionCanceled, ErrValidation, ErrItemTooLarge}
+
+	tests := []struct {
+		name  string
+		err   error
+		wants []error
+	}{
+		{
+			name:  "conditional check failures should be condition failures",
+			err:   awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil),
+			wants: []error{ErrConditionFailed},
+		},
+		{
+			name:  "exceeded throughput should be throttling",
+			err:   awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil),
+			wants: []error{ErrThrottled},
+		},
+		{
+			name:  "exceeded request limits should be throttling",
+			err:   awserr.New(dynamodb.ErrCodeRequestLimitExceeded, "slow down", nil),
+			wants: []error{ErrThrottled},
+		},
+		{
+			name:  "throttling exceptions should be throttling",
+			err:   awserr.New("ThrottlingException", "slow down", nil),
+			wants: []error{ErrThrottled},
+		},
+		{
+			name:  "validation exceptions should be validation failures",
+			err:   awserr.New("ValidationException", "One or more parameter values were invalid", nil),
+			wants: []error{ErrValidation},
+		},
+		{
+			name:  "oversized items should be too large and validation failures",
+			err:   awserr.New("ValidationException", "Item size has exceeded the maximum allowed size", nil),
+			wants: []error{ErrItemTooLarge, ErrValidation},
+		},
+		{
+			name:  "oversized item collections should be too large",
+			err:   awserr.New(dynamodb.ErrCodeItemCollectionSizeLimitExceededException, "Collection size exceeded", nil),
+			wants: []error{ErrItemTooLarge, ErrValidation},
+		},
+		{
+			name: "canceled transactions should be canceled and condition failures when a condition failed",
+			err: &dynamodb.TransactionCanceledException{
+				Message_: aws.String("Transaction cancelled"),
+				CancellationReasons: []*dynamodb.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")},
+				},
+			},
+			wants: []error{ErrTransactionCanceled, ErrConditionFailed},
+		},
+		{
+			name:  "unknown errors should be left alone",
+			err:   awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil),
+			wants: nil,
+		},
+		{
+			name:  "errors from elsewhere should be left alone",
+			err:   fmt.Errorf("boom"),
+			wants: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := errors.Wrap(classifyError(tt.err), "request failed")
+			for _, kind := range kinds {
+				want := false
+				for _, w := range tt.wants {
+					want = want || w == kind
+				}
+				if errors.Is(err, kind) != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, kind, !want, want)
+				}
+			}
+			if !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %q does not mention its cause %q", err, tt.err)
+			}
+			var aerr awserr.Error
+			if _, isAWS := tt.err.(awserr.Error); isAWS && !errors.As(err, &aerr) {
+				t.Errorf("errors.As(%v, awserr.Error) = false, want the cause", err)
+			}
+		})
+	}
+}
+
+func TestWorker_ErrorKinds(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess, testTask{ID: "1", Amount: 1})
+
+	var canceled *TransactionCanceledError
+	tests := []struct {
+		name string
+		do   func() error
+		want error
+	}{
+		{
+			name: "getting a missing item should be not found",
+			do:   func() error { return NewWorker(sess, testTaskTable).Key("ID", "2").Get(&testTask{}) },
+			want: ErrNotFound,
+		},
+		{
+			name: "saving an oversized item should be too large",
+			do: func() error {
+				return NewWorker(sess, testTaskTable).Save(&testTask{ID: "2", TaskName: strings.Repeat("x", 400<<10)})
+			},
+			want: ErrItemTooLarge,
+		},
+		{
+			name: "batch saving an oversized item should be too large",
+			do: func() error {
+				return NewWorker(sess, testTaskTable).BatchSave([]interface{}{testTask{ID: "2", TaskName: strings.Repeat("x", 400<<10)}})
+			},
+			want: ErrItemTooLarge,
+		},
+		{
+			name: "filtering a query on a key attribute should be a validation failure",
+			do: func() error {
+				_, err := NewWorker(sess, testTaskTable).Key("ID", "1").FilterCondition(expression.Name("ID").Equal(expression.Value("1"))).Query(&[]testTask{})
+				return err
+			},
+			want: ErrValidation,
+		},
+		{
+			name: "a transaction with a failing condition should be canceled",
+			do: func() error {
+				return NewTransaction(sess, []*dynamodb.Update{
+					{
+						TableName:                 aws.String(testTaskTable),
+						Key:                       map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("1")}},
+						UpdateExpression:          aws.String("SET Amount = :a"),
+						ConditionExpression:       aws.String("Amount > :a"),
+						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":a": {N: aws.String("5")}},
+					},
+				}).Transacte()
+			},
+			want: ErrTransactionCanceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.do()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if tt.want == ErrTransactionCanceled {
+				if !errors.As(err, &canceled) || len(canceled.Reasons) != 1 || canceled.Reasons[0].Code != "ConditionalCheckFailed" {
+					t.Errorf("error = %#v, want one ConditionalCheckFailed reason", err)
+				}
+			}
+		})
+	}
+}
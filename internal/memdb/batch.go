@@ -0,0 +1,213 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	maxBatchGetKeys   = 100
+	maxBatchWriteReqs = 25
+)
+
+type keysAndAttributes struct {
+	legacyParams
+	exprParams
+
+	Keys                 []item
+	ConsistentRead       bool    `json:",omitempty"`
+	ProjectionExpression *string `json:",omitempty"`
+}
+
+type batchGetItemInput struct {
+	RequestItems map[string]*keysAndAttributes
+}
+
+type batchGetItemOutput struct {
+	Responses       map[string][]item
+	UnprocessedKeys map[string]*keysAndAttributes
+}
+
+func (db *DB) batchGetItem(in *batchGetItemInput) (*batchGetItemOutput, error) {
+	total := 0
+	for _, ka := range in.RequestItems {
+		if err := ka.check(); err != nil {
+			return nil, err
+		}
+		total += len(ka.Keys)
+	}
+	if total == 0 {
+		return nil, newError("ValidationException", "1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Member must have length greater than or equal to 1")
+	}
+	if total > maxBatchGetKeys {
+		return nil, newError("ValidationException", "Too many items requested for the BatchGetItem call")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	out := &batchGetItemOutput{
+		Responses:       map[string][]item{},
+		UnprocessedKeys: map[string]*keysAndAttributes{},
+	}
+	names := make([]string, 0, len(in.RequestItems))
+	for name := range in.RequestItems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	processed := 0
+	for _, name := range names {
+		ka := in.RequestItems[name]
+		t, err := db.table(name)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := ka.parser()
+		if err != nil {
+			return nil, validationError(err)
+		}
+		var paths []path
+		if ka.ProjectionExpression != nil {
+			if paths, err = p.projection(*ka.ProjectionExpression); err != nil {
+				return nil, validationError(fmt.Errorf("Invalid ProjectionExpression: %s", err))
+			}
+		}
+		if err := p.checkUnused(); err != nil {
+			return nil, validationError(err)
+		}
+
+		seen := map[string]bool{}
+		results := []item{}
+		for _, key := range ka.Keys {
+			if err := t.checkKey(key); err != nil {
+				return nil, validationError(err)
+			}
+			ks := t.keyString(key)
+			if seen[ks] {
+				return nil, newError("ValidationException", "Provided list of item keys contains duplicates")
+			}
+			seen[ks] = true
+			if db.MaxBatchGets > 0 && processed >= db.MaxBatchGets {
+				u, ok := out.UnprocessedKeys[name]
+				if !ok {
+					copied := *ka
+					u = &copied
+					u.Keys = nil
+					out.UnprocessedKeys[name] = u
+				}
+				u.Keys = append(u.Keys, key)
+				continue
+			}
+			processed++
+			if it, ok := t.items[ks]; ok {
+				results = append(results, project(it, paths))
+			}
+		}
+		out.Responses[name] = results
+	}
+	return out, nil
+}
+
+type putRequest struct {
+	Item item
+}
+
+type deleteRequest struct {
+	Key item
+}
+
+type writeRequest struct {
+	PutRequest    *putRequest    `json:",omitempty"`
+	DeleteRequest *deleteRequest `json:",omitempty"`
+}
+
+type batchWriteItemInput struct {
+	RequestItems map[string][]writeRequest
+}
+
+type batchWriteItemOutput struct {
+	UnprocessedItems map[string][]writeRequest
+}
+
+func (db *DB) batchWriteItem(in *batchWriteItemInput) (*batchWriteItemOutput, error) {
+	total := 0
+	for _, reqs := range in.RequestItems {
+		total += len(reqs)
+	}
+	if total == 0 {
+		return nil, newError("ValidationException", "1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Member must have length greater than or equal to 1")
+	}
+	if total > maxBatchWriteReqs {
+		return nil, newError("ValidationException", "1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Map value must satisfy constraint: [Member must have length less than or equal to 25, Member must have length greater than or equal to 1]")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	type write struct {
+		t   *table
+		ks  string
+		put item
+		req writeRequest
+	}
+
+	// Validate everything before applying anything: a bad request in the
+	// batch rejects the whole call.
+	names := make([]string, 0, len(in.RequestItems))
+	for name := range in.RequestItems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var writes []write
+	for _, name := range names {
+		t, err := db.table(name)
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, req := range in.RequestItems[name] {
+			var w write
+			switch {
+			case req.PutRequest != nil && req.DeleteRequest == nil:
+				if err := t.checkItem(req.PutRequest.Item); err != nil {
+					return nil, validationError(err)
+				}
+				w = write{t: t, ks: t.keyString(t.keyOf(req.PutRequest.Item)), put: req.PutRequest.Item}
+			case req.DeleteRequest != nil && req.PutRequest == nil:
+				if err := t.checkKey(req.DeleteRequest.Key); err != nil {
+					return nil, validationError(err)
+				}
+				w = write{t: t, ks: t.keyString(req.DeleteRequest.Key)}
+			default:
+				return nil, newError("ValidationException", "A WriteRequest must contain exactly one of PutRequest or DeleteRequest")
+			}
+			if seen[w.ks] {
+				return nil, newError("ValidationException", "Provided list of item keys contains duplicates")
+			}
+			seen[w.ks] = true
+			if db.locks[db.lockKey(name, w.ks)] {
+				return nil, transactionConflict()
+			}
+			w.req = req
+			writes = append(writes, w)
+		}
+	}
+
+	out := &batchWriteItemOutput{UnprocessedItems: map[string][]writeRequest{}}
+	for i, w := range writes {
+		if db.MaxBatchWrites > 0 && i >= db.MaxBatchWrites {
+			name := w.t.desc.TableName
+			out.UnprocessedItems[name] = append(out.UnprocessedItems[name], w.req)
+			continue
+		}
+		if w.put != nil {
+			w.t.items[w.ks] = w.put.clone()
+		} else {
+			delete(w.t.items, w.ks)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,283 @@
+// Package memdb is the in-memory DynamoDB behind both versions of
+// ddbmodeltest. It speaks the DynamoDB JSON 1.0 wire protocol and uses no
+// AWS SDK, which each ddbmodeltest plugs in through HTTPClient.
+package memdb
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Region is the region of the tables of a DB, which clients of it are
+// configured with.
+const Region = "local"
+
+const fakeAccount = "000000000000"
+
+type DB struct {
+	// TransactionDelay keeps the items of a TransactWriteItems call locked
+	// for this long between validation and commit, so that concurrent
+	// writers and TransactGetItems readers observe TransactionConflict as
+	// they would against DynamoDB.
+	TransactionDelay time.Duration
+
+	// MaxBatchWrites caps the write requests a BatchWriteItem call
+	// processes; the rest come back as UnprocessedItems, as they do when
+	// DynamoDB is throttling. Zero means no cap.
+	MaxBatchWrites int
+	// MaxBatchGets likewise caps the keys a BatchGetItem call reads; the
+	// rest come back as UnprocessedKeys.
+	MaxBatchGets int
+
+	// IndexCreationDelay keeps a global index that UpdateTable adds
+	// CREATING, and unreadable, for this long, as DynamoDB does while it
+	// backfills the index.
+	IndexCreationDelay time.Duration
+
+	mu     sync.Mutex
+	tables map[string]*table
+	locks  map[string]bool
+	tokens map[string]tokenEntry
+
+	serveOnce sync.Once
+	server    *httptest.Server
+
+	// path is the backing file of a DB created by Open.
+	path      string
+	persistMu sync.Mutex
+}
+
+func New() *DB {
+	return &DB{
+		tables: map[string]*table{},
+		locks:  map[string]bool{},
+		tokens: map[string]tokenEntry{},
+	}
+}
+
+// KeyDef names a key attribute and its scalar type: "S", "N" or "B".
+type KeyDef struct {
+	Name string
+	Type string
+}
+
+type IndexDef struct {
+	Name     string
+	HashKey  KeyDef
+	RangeKey KeyDef
+	// Local creates a local secondary index instead of a global one.
+	Local bool
+	// Projection is ALL (the default), KEYS_ONLY or INCLUDE.
+	Projection       string
+	NonKeyAttributes []string
+}
+
+type TableDef struct {
+	Name     string
+	HashKey  KeyDef
+	RangeKey KeyDef
+	Indexes  []IndexDef
+}
+
+// CreateTable creates a table without going through an SDK client.
+func (db *DB) CreateTable(def TableDef) error {
+	in := &createTableInput{
+		TableName:   def.Name,
+		BillingMode: "PAY_PER_REQUEST",
+	}
+
+	defined := map[string]bool{}
+	keySchema := func(hash, rng KeyDef) []keySchemaElement {
+		var ks []keySchemaElement
+		for _, k := range []KeyDef{hash, rng} {
+			if k.Name == "" {
+				continue
+			}
+			keyType := "HASH"
+			if len(ks) > 0 {
+				keyType = "RANGE"
+			}
+			ks = append(ks, keySchemaElement{AttributeName: k.Name, KeyType: keyType})
+			if !defined[k.Name] {
+				defined[k.Name] = true
+				in.AttributeDefinitions = append(in.AttributeDefinitions, attributeDefinition{
+					AttributeName: k.Name,
+					AttributeType: k.Type,
+				})
+			}
+		}
+		return ks
+	}
+
+	in.KeySchema = keySchema(def.HashKey, def.RangeKey)
+	for _, idx := range def.Indexes {
+		d := indexDescription{
+			IndexName: idx.Name,
+			KeySchema: keySchema(idx.HashKey, idx.RangeKey),
+			Projection: projection{
+				ProjectionType:   idx.Projection,
+				NonKeyAttributes: idx.NonKeyAttributes,
+			},
+		}
+		if idx.Local {
+			in.LocalSecondaryIndexes = append(in.LocalSecondaryIndexes, d)
+		} else {
+			in.GlobalSecondaryIndexes = append(in.GlobalSecondaryIndexes, d)
+		}
+	}
+
+	_, err := db.createTable(in)
+	if err != nil {
+		return err
+	}
+	return db.persist()
+}
+
+func (db *DB) table(name string) (*table, error) {
+	t, ok := db.tables[name]
+	if !ok {
+		return nil, resourceNotFound()
+	}
+	return t, nil
+}
+
+func tableArn(name string) string {
+	return fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s", Region, fakeAccount, name)
+}
+
+type createTableInput struct {
+	legacyParams
+
+	TableName              string
+	AttributeDefinitions   []attributeDefinition
+	KeySchema              []keySchemaElement
+	GlobalSecondaryIndexes []indexDescription
+	LocalSecondaryIndexes  []indexDescription
+	BillingMode            string
+	ProvisionedThroughput  *provisionedThroughput
+	StreamSpecification    *streamSpecification
+}
+
+type tableDescriptionOutput struct {
+	TableDescription tableDescription
+}
+
+func (db *DB) createTable(in *createTableInput) (*tableDescriptionOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if in.TableName == "" {
+		return nil, newError("ValidationException", "TableName must be at least 3 characters long and at most 255 characters long")
+	}
+	if _, ok := db.tables[in.TableName]; ok {
+		return nil, newError("ResourceInUseException", "Table already exists: %s", in.TableName)
+	}
+
+	now := time.Now()
+	desc := tableDescription{
+		TableName:              in.TableName,
+		TableArn:               tableArn(in.TableName),
+		TableId:                fmt.Sprintf("%08x-0000-0000-0000-%012x", len(db.tables), now.UnixNano()&0xffffffffffff),
+		TableStatus:            "ACTIVE",
+		CreationDateTime:       float64(now.UnixNano()) / 1e9,
+		AttributeDefinitions:   in.AttributeDefinitions,
+		KeySchema:              in.KeySchema,
+		GlobalSecondaryIndexes: in.GlobalSecondaryIndexes,
+		LocalSecondaryIndexes:  in.LocalSecondaryIndexes,
+		ProvisionedThroughput:  &provisionedThroughput{},
+	}
+
+	switch in.BillingMode {
+	case "PAY_PER_REQUEST":
+		desc.BillingModeSummary = &billingModeSummary{BillingMode: in.BillingMode}
+	case "", "PROVISIONED":
+		if in.ProvisionedThroughput == nil {
+			return nil, newError("ValidationException", "One or more parameter values were invalid: ReadCapacityUnits and WriteCapacityUnits must both be specified when BillingMode is PROVISIONED")
+		}
+		desc.ProvisionedThroughput = in.ProvisionedThroughput
+		desc.BillingModeSummary = &billingModeSummary{BillingMode: "PROVISIONED"}
+	default:
+		return nil, newError("ValidationException", "1 validation error detected: Value '%s' at 'billingMode' failed to satisfy constraint: Member must satisfy enum value set: [PROVISIONED, PAY_PER_REQUEST]", in.BillingMode)
+	}
+
+	if s := in.StreamSpecification; s != nil && s.StreamEnabled {
+		desc.StreamSpecification = s
+		desc.LatestStreamLabel = now.UTC().Format("2006-01-02T15:04:05.000")
+		desc.LatestStreamArn = desc.TableArn + "/stream/" + desc.LatestStreamLabel
+	}
+
+	t, err := newTable(desc)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	db.tables[in.TableName] = t
+
+	return &tableDescriptionOutput{TableDescription: t.describe()}, nil
+}
+
+type tableNameInput struct {
+	TableName string
+}
+
+func (db *DB) deleteTable(in *tableNameInput) (*tableDescriptionOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(db.tables, in.TableName)
+
+	desc := t.describe()
+	desc.TableStatus = "DELETING"
+	return &tableDescriptionOutput{TableDescription: desc}, nil
+}
+
+type describeTableOutput struct {
+	Table tableDescription
+}
+
+func (db *DB) describeTable(in *tableNameInput) (*describeTableOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &describeTableOutput{Table: t.describe()}, nil
+}
+
+type listTablesInput struct {
+	ExclusiveStartTableName string
+	Limit                   int
+}
+
+type listTablesOutput struct {
+	TableNames             []string
+	LastEvaluatedTableName string `json:",omitempty"`
+}
+
+func (db *DB) listTables(in *listTablesInput) (*listTablesOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		if name > in.ExclusiveStartTableName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	out := &listTablesOutput{TableNames: names}
+	if in.Limit > 0 && len(names) > in.Limit {
+		out.TableNames = names[:in.Limit]
+		out.LastEvaluatedTableName = names[in.Limit-1]
+	}
+	return out, nil
+}
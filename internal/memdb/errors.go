@@ -0,0 +1,76 @@
+package memdb
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// apiError is an error response in the DynamoDB JSON protocol.
+type apiError struct {
+	code    string
+	message string
+	status  int
+
+	// ConditionalCheckFailedException with ReturnValuesOnConditionCheckFailure.
+	item item
+	// TransactionCanceledException.
+	reasons []cancellationReason
+}
+
+type cancellationReason struct {
+	Code    string
+	Message string `json:",omitempty"`
+	Item    item   `json:",omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func (e *apiError) typeName() string {
+	if e.code == "ValidationException" {
+		return "com.amazon.coral.validate#" + e.code
+	}
+	return "com.amazonaws.dynamodb.v20120810#" + e.code
+}
+
+func (e *apiError) body() interface{} {
+	out := map[string]interface{}{
+		"__type":  e.typeName(),
+		"message": e.message,
+	}
+	if e.item != nil {
+		out["Item"] = e.item
+	}
+	if e.reasons != nil {
+		out["CancellationReasons"] = e.reasons
+	}
+	return out
+}
+
+func newError(code, format string, args ...interface{}) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...), status: http.StatusBadRequest}
+}
+
+func validationError(err error) *apiError {
+	if e, ok := err.(*apiError); ok {
+		return e
+	}
+	return newError("ValidationException", "%s", err.Error())
+}
+
+func resourceNotFound() *apiError {
+	return newError("ResourceNotFoundException", "Requested resource not found")
+}
+
+func conditionalCheckFailed(old item, returnValues string) *apiError {
+	e := newError("ConditionalCheckFailedException", "The conditional request failed")
+	if returnValues == "ALL_OLD" && old != nil {
+		e.item = old.clone()
+	}
+	return e
+}
+
+func transactionConflict() *apiError {
+	return newError("TransactionConflictException", "Transaction is ongoing for the item")
+}
@@ -0,0 +1,486 @@
+package memdb
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// resolve walks a document path, returning nil when any step is missing.
+func resolve(it item, p path) *value {
+	if len(p) == 0 || p[0].isIndex {
+		return nil
+	}
+	cur := it[p[0].name]
+	for _, e := range p[1:] {
+		if cur == nil {
+			return nil
+		}
+		if e.isIndex {
+			if cur.typ != "L" || e.index >= len(cur.l) {
+				return nil
+			}
+			cur = cur.l[e.index]
+		} else {
+			if cur.typ != "M" {
+				return nil
+			}
+			cur = cur.m[e.name]
+		}
+	}
+	return cur
+}
+
+func evalOperand(it item, op operand) *value {
+	switch o := op.(type) {
+	case *pathOperand:
+		return resolve(it, o.path)
+	case *valueOperand:
+		return o.v
+	case *sizeOperand:
+		v := resolve(it, o.path)
+		if v == nil {
+			return nil
+		}
+		n, ok := v.length()
+		if !ok {
+			return nil
+		}
+		return &value{typ: "N", s: fmt.Sprint(n)}
+	}
+	return nil
+}
+
+func evalCondition(it item, c condition) (bool, error) {
+	switch c := c.(type) {
+	case *andCond:
+		a, err := evalCondition(it, c.a)
+		if err != nil || !a {
+			return false, err
+		}
+		return evalCondition(it, c.b)
+	case *orCond:
+		a, err := evalCondition(it, c.a)
+		if err != nil || a {
+			return a, err
+		}
+		return evalCondition(it, c.b)
+	case *notCond:
+		a, err := evalCondition(it, c.c)
+		return !a, err
+	case *compareCond:
+		a, b := evalOperand(it, c.a), evalOperand(it, c.b)
+		switch c.op {
+		case "=":
+			return equal(a, b), nil
+		case "<>":
+			return !equal(a, b), nil
+		}
+		n, ok := compare(a, b)
+		if !ok {
+			return false, nil
+		}
+		switch c.op {
+		case "<":
+			return n < 0, nil
+		case "<=":
+			return n <= 0, nil
+		case ">":
+			return n > 0, nil
+		case ">=":
+			return n >= 0, nil
+		}
+	case *betweenCond:
+		v, lo, hi := evalOperand(it, c.v), evalOperand(it, c.lo), evalOperand(it, c.hi)
+		if n, ok := compare(lo, hi); ok && n > 0 {
+			return false, fmt.Errorf("Invalid ConditionExpression: The BETWEEN operator requires upper bound to be greater than or equal to lower bound")
+		}
+		n1, ok1 := compare(v, lo)
+		n2, ok2 := compare(v, hi)
+		return ok1 && ok2 && n1 >= 0 && n2 <= 0, nil
+	case *inCond:
+		v := evalOperand(it, c.v)
+		for _, op := range c.list {
+			if equal(v, evalOperand(it, op)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *funcCond:
+		return evalFunc(it, c)
+	}
+	return false, fmt.Errorf("unsupported condition %T", c)
+}
+
+func evalFunc(it item, c *funcCond) (bool, error) {
+	target := evalOperand(it, c.args[0])
+	switch c.name {
+	case "attribute_exists":
+		return target != nil, nil
+	case "attribute_not_exists":
+		return target == nil, nil
+	case "attribute_type":
+		t := evalOperand(it, c.args[1])
+		if t == nil || t.typ != "S" {
+			return false, fmt.Errorf("Invalid ConditionExpression: Incorrect operand type for operator or function; operator or function: attribute_type")
+		}
+		switch t.s {
+		case "S", "SS", "N", "NS", "B", "BS", "BOOL", "NULL", "L", "M":
+		default:
+			return false, fmt.Errorf("Invalid ConditionExpression: Invalid attribute type name found; type: %s", t.s)
+		}
+		return target != nil && target.typ == t.s, nil
+	case "begins_with":
+		prefix := evalOperand(it, c.args[1])
+		if target == nil || prefix == nil || target.typ != prefix.typ {
+			return false, nil
+		}
+		switch target.typ {
+		case "S":
+			return strings.HasPrefix(target.s, prefix.s), nil
+		case "B":
+			return bytes.HasPrefix(target.b, prefix.b), nil
+		}
+		return false, nil
+	case "contains":
+		operand := evalOperand(it, c.args[1])
+		if target == nil || operand == nil {
+			return false, nil
+		}
+		switch target.typ {
+		case "S":
+			return operand.typ == "S" && strings.Contains(target.s, operand.s), nil
+		case "B":
+			return operand.typ == "B" && bytes.Contains(target.b, operand.b), nil
+		case "SS", "NS", "BS":
+			for _, e := range target.elements() {
+				if equal(e, operand) {
+					return true, nil
+				}
+			}
+		case "L":
+			for _, e := range target.l {
+				if equal(e, operand) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported function %s", c.name)
+}
+
+// project returns a copy of it restricted to paths, keeping the nesting of
+// map and list elements that were asked for.
+func project(it item, paths []path) item {
+	if len(paths) == 0 {
+		return it.clone()
+	}
+	out := item{}
+	for _, p := range paths {
+		v := resolve(it, p)
+		if v == nil {
+			continue
+		}
+		wrapper := &value{typ: "M", m: out}
+		projectInto(wrapper, p, v.clone())
+	}
+	return out
+}
+
+func projectInto(dst *value, p path, v *value) {
+	cur := dst
+	for i, e := range p {
+		last := i == len(p)-1
+		if e.isIndex {
+			// Projected list elements are compacted, as DynamoDB does.
+			if last {
+				cur.l = append(cur.l, v)
+				return
+			}
+			next := &value{typ: p.childType(i)}
+			cur.l = append(cur.l, next)
+			cur = next
+			continue
+		}
+		if last {
+			cur.m[e.name] = v
+			return
+		}
+		next, ok := cur.m[e.name]
+		if !ok {
+			next = &value{typ: p.childType(i), m: map[string]*value{}}
+			cur.m[e.name] = next
+		}
+		cur = next
+	}
+}
+
+func (p path) lastIndex() int {
+	if e := p[len(p)-1]; e.isIndex {
+		return e.index
+	}
+	return -1
+}
+
+func (p path) childType(i int) string {
+	if p[i+1].isIndex {
+		return "L"
+	}
+	return "M"
+}
+
+type evalError struct{ msg string }
+
+func (e *evalError) Error() string { return e.msg }
+
+func invalidUpdate(format string, args ...interface{}) error {
+	return &evalError{msg: "Invalid UpdateExpression: " + fmt.Sprintf(format, args...)}
+}
+
+func evalSetValue(it item, op operand) (*value, error) {
+	switch o := op.(type) {
+	case *pathOperand:
+		v := resolve(it, o.path)
+		if v == nil {
+			return nil, &evalError{msg: "The provided expression refers to an attribute that does not exist in the item"}
+		}
+		return v.clone(), nil
+	case *valueOperand:
+		return o.v.clone(), nil
+	case *ifNotExistsOperand:
+		if v := resolve(it, o.path); v != nil {
+			return v.clone(), nil
+		}
+		return evalSetValue(it, o.def)
+	case *listAppendOperand:
+		a, err := evalSetValue(it, o.a)
+		if err != nil {
+			return nil, err
+		}
+		b, err := evalSetValue(it, o.b)
+		if err != nil {
+			return nil, err
+		}
+		if a.typ != "L" || b.typ != "L" {
+			return nil, invalidUpdate("Incorrect operand type for operator or function; operator or function: list_append")
+		}
+		return &value{typ: "L", l: append(append([]*value{}, a.l...), b.l...)}, nil
+	case *arithOperand:
+		a, err := evalSetValue(it, o.a)
+		if err != nil {
+			return nil, err
+		}
+		b, err := evalSetValue(it, o.b)
+		if err != nil {
+			return nil, err
+		}
+		if a.typ != "N" || b.typ != "N" {
+			return nil, invalidUpdate("Incorrect operand type for operator or function; operator: %s", o.op)
+		}
+		ra, _ := parseNumber(a.s)
+		rb, _ := parseNumber(b.s)
+		r := new(big.Rat)
+		if o.op == "+" {
+			r.Add(ra, rb)
+		} else {
+			r.Sub(ra, rb)
+		}
+		return &value{typ: "N", s: formatNumber(r)}, nil
+	}
+	return nil, invalidUpdate("unsupported operand %T", op)
+}
+
+// setPath assigns v at p. Intermediate maps and lists must already exist.
+func setPath(it item, p path, v *value) error {
+	if len(p) == 1 {
+		it[p[0].name] = v
+		return nil
+	}
+	parent := resolve(it, p[:len(p)-1])
+	last := p[len(p)-1]
+	switch {
+	case parent == nil:
+	case last.isIndex && parent.typ == "L":
+		if last.index < len(parent.l) {
+			parent.l[last.index] = v
+		} else {
+			parent.l = append(parent.l, v)
+		}
+		return nil
+	case !last.isIndex && parent.typ == "M":
+		if parent.m == nil {
+			parent.m = map[string]*value{}
+		}
+		parent.m[last.name] = v
+		return nil
+	}
+	return &evalError{msg: "The document path provided in the update expression is invalid for update"}
+}
+
+func removePath(it item, p path) error {
+	if len(p) == 1 {
+		delete(it, p[0].name)
+		return nil
+	}
+	parent := resolve(it, p[:len(p)-1])
+	last := p[len(p)-1]
+	switch {
+	case parent == nil:
+		return nil
+	case last.isIndex && parent.typ == "L":
+		if last.index < len(parent.l) {
+			parent.l = append(parent.l[:last.index], parent.l[last.index+1:]...)
+		}
+		return nil
+	case !last.isIndex && parent.typ == "M":
+		delete(parent.m, last.name)
+		return nil
+	}
+	return &evalError{msg: "The document path provided in the update expression is invalid for update"}
+}
+
+// applyUpdate evaluates every action against the original item, as DynamoDB
+// does, and then writes the results into a copy.
+func applyUpdate(old item, u *updateExpr) (item, error) {
+	type assignment struct {
+		path path
+		v    *value
+	}
+
+	var sets []assignment
+	for _, a := range u.set {
+		v, err := evalSetValue(old, a.value)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, assignment{path: a.path, v: v})
+	}
+
+	for _, a := range u.add {
+		if len(a.path) > 1 {
+			return nil, invalidUpdate("ADD action can only be used on top-level attributes; path: %s", a.path)
+		}
+		inc := a.value.(*valueOperand).v
+		cur := resolve(old, a.path)
+		switch inc.typ {
+		case "N":
+			if cur == nil {
+				sets = append(sets, assignment{path: a.path, v: inc.clone()})
+				continue
+			}
+			if cur.typ != "N" {
+				return nil, invalidUpdate("Incorrect operand type for operator or function; operator: ADD, operand type: %s", cur.typ)
+			}
+			ra, _ := parseNumber(cur.s)
+			rb, _ := parseNumber(inc.s)
+			sets = append(sets, assignment{path: a.path, v: &value{typ: "N", s: formatNumber(new(big.Rat).Add(ra, rb))}})
+		case "SS", "NS", "BS":
+			if cur == nil {
+				sets = append(sets, assignment{path: a.path, v: inc.clone()})
+				continue
+			}
+			if cur.typ != inc.typ {
+				return nil, invalidUpdate("Incorrect operand type for operator or function; operator: ADD, operand type: %s", cur.typ)
+			}
+			elems := cur.elements()
+			seen := map[string]bool{}
+			for _, e := range elems {
+				seen[e.keyString()] = true
+			}
+			for _, e := range inc.elements() {
+				if !seen[e.keyString()] {
+					seen[e.keyString()] = true
+					elems = append(elems, e)
+				}
+			}
+			sets = append(sets, assignment{path: a.path, v: setFromElements(cur.typ, elems)})
+		default:
+			return nil, invalidUpdate("Incorrect operand type for operator or function; operator: ADD, operand type: %s", inc.typ)
+		}
+	}
+
+	var removes []path
+	removes = append(removes, u.remove...)
+	for _, a := range u.delete {
+		if len(a.path) > 1 {
+			return nil, invalidUpdate("DELETE action can only be used on top-level attributes; path: %s", a.path)
+		}
+		del := a.value.(*valueOperand).v
+		switch del.typ {
+		case "SS", "NS", "BS":
+		default:
+			return nil, invalidUpdate("Incorrect operand type for operator or function; operator: DELETE, operand type: %s", del.typ)
+		}
+		cur := resolve(old, a.path)
+		if cur == nil {
+			continue
+		}
+		if cur.typ != del.typ {
+			return nil, invalidUpdate("Incorrect operand type for operator or function; operator: DELETE, operand type: %s", cur.typ)
+		}
+		drop := map[string]bool{}
+		for _, e := range del.elements() {
+			drop[e.keyString()] = true
+		}
+		var keep []*value
+		for _, e := range cur.elements() {
+			if !drop[e.keyString()] {
+				keep = append(keep, e)
+			}
+		}
+		if len(keep) == 0 {
+			removes = append(removes, a.path)
+		} else {
+			sets = append(sets, assignment{path: a.path, v: setFromElements(cur.typ, keep)})
+		}
+	}
+
+	out := old.clone()
+	if out == nil {
+		out = item{}
+	}
+	for _, s := range sets {
+		if err := setPath(out, s.path, s.v); err != nil {
+			return nil, err
+		}
+	}
+	// Remove list elements from the highest index down so earlier removals do
+	// not shift later ones.
+	sort.SliceStable(removes, func(i, j int) bool {
+		return removes[i].lastIndex() > removes[j].lastIndex()
+	})
+	for _, p := range removes {
+		if err := removePath(out, p); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// updatedNames lists the top-level attributes an update expression touches.
+func (u *updateExpr) updatedNames() []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(p path) {
+		if !seen[p[0].name] {
+			seen[p[0].name] = true
+			out = append(out, p[0].name)
+		}
+	}
+	for _, a := range u.set {
+		add(a.path)
+	}
+	for _, p := range u.remove {
+		add(p)
+	}
+	for _, a := range u.add {
+		add(a.path)
+	}
+	for _, a := range u.delete {
+		add(a.path)
+	}
+	return out
+}
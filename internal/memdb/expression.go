@@ -0,0 +1,708 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The expression grammar follows the DynamoDB developer guide: condition,
+// key condition, filter, projection and update expressions all share the
+// lexer and the operand/path rules below.
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName  // #name
+	tokValue // :value
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("Syntax error; token: %q, near: %q", string(c), s[i:])
+			}
+			kind := tokName
+			if c == ':' {
+				kind = tokValue
+			}
+			toks = append(toks, token{kind: kind, text: s[i:j], pos: i})
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, text: s[i:j], pos: i})
+			i = j
+		case c == '<' || c == '>':
+			if i+1 < len(s) && (s[i+1] == '=' || (c == '<' && s[i+1] == '>')) {
+				toks = append(toks, token{kind: tokPunct, text: s[i : i+2], pos: i})
+				i += 2
+			} else {
+				toks = append(toks, token{kind: tokPunct, text: s[i : i+1], pos: i})
+				i++
+			}
+		case strings.IndexByte("=(),.[]+-", c) >= 0:
+			toks = append(toks, token{kind: tokPunct, text: s[i : i+1], pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("Invalid character %q in expression", string(c))
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(s)})
+	return toks, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+// pathElem is one step of a document path: a map key or a list index.
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type path []pathElem
+
+func (p path) String() string {
+	var sb strings.Builder
+	for i, e := range p {
+		if e.isIndex {
+			fmt.Fprintf(&sb, "[%d]", e.index)
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(e.name)
+	}
+	return sb.String()
+}
+
+// overlaps reports whether one path is a prefix of the other.
+func (p path) overlaps(q path) bool {
+	n := len(p)
+	if len(q) < n {
+		n = len(q)
+	}
+	for i := 0; i < n; i++ {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Operands.
+type (
+	pathOperand  struct{ path path }
+	valueOperand struct{ v *value }
+	sizeOperand  struct{ path path }
+	// Only valid on the right hand side of SET actions.
+	ifNotExistsOperand struct {
+		path path
+		def  operand
+	}
+	listAppendOperand struct{ a, b operand }
+	arithOperand      struct {
+		op   string
+		a, b operand
+	}
+)
+
+type operand interface{}
+
+// Conditions.
+type (
+	compareCond struct {
+		op   string
+		a, b operand
+	}
+	betweenCond struct{ v, lo, hi operand }
+	inCond      struct {
+		v    operand
+		list []operand
+	}
+	andCond  struct{ a, b condition }
+	orCond   struct{ a, b condition }
+	notCond  struct{ c condition }
+	funcCond struct {
+		name string
+		args []operand
+	}
+)
+
+type condition interface{}
+
+type updateAction struct {
+	path  path
+	value operand
+}
+
+type updateExpr struct {
+	set    []updateAction
+	remove []path
+	add    []updateAction
+	delete []updateAction
+}
+
+// parser turns expression strings into trees, resolving #name and :value
+// placeholders and recording which ones were used.
+type parser struct {
+	names  map[string]string
+	values map[string]*value
+
+	usedNames  map[string]bool
+	usedValues map[string]bool
+
+	toks []token
+	pos  int
+}
+
+func newParser(names map[string]string, values map[string]*value) *parser {
+	return &parser{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}
+}
+
+// checkUnused mirrors DynamoDB's rejection of placeholders that no
+// expression in the request referred to.
+func (p *parser) checkUnused() error {
+	for _, k := range sortedStrings(p.names) {
+		if !p.usedNames[k] {
+			return fmt.Errorf("Value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", k)
+		}
+	}
+	for _, k := range sortedNames(p.values) {
+		if !p.usedValues[k] {
+			return fmt.Errorf("Value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", k)
+		}
+	}
+	return nil
+}
+
+func (p *parser) reset(s string) error {
+	toks, err := tokenize(s)
+	if err != nil {
+		return err
+	}
+	p.toks = toks
+	p.pos = 0
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == text
+}
+
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) expectPunct(text string) error {
+	t := p.next()
+	if t.kind != tokPunct || t.text != text {
+		return p.syntaxError(t)
+	}
+	return nil
+}
+
+func (p *parser) syntaxError(t token) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("Syntax error; token: <EOF>")
+	}
+	return fmt.Errorf("Syntax error; token: %q, near char %d", t.text, t.pos)
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokEOF {
+		return p.syntaxError(t)
+	}
+	return nil
+}
+
+func (p *parser) parsePath() (path, error) {
+	var out path
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokIdent:
+			out = append(out, pathElem{name: t.text})
+		case tokName:
+			name, ok := p.names[t.text]
+			if !ok {
+				return nil, fmt.Errorf("An expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+			}
+			p.usedNames[t.text] = true
+			out = append(out, pathElem{name: name})
+		default:
+			return nil, p.syntaxError(t)
+		}
+
+		for p.isPunct("[") {
+			p.next()
+			t := p.next()
+			if t.kind != tokNumber {
+				return nil, p.syntaxError(t)
+			}
+			idx, _ := strconv.Atoi(t.text)
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			out = append(out, pathElem{index: idx, isIndex: true})
+		}
+
+		if !p.isPunct(".") {
+			return out, nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseValueRef() (*value, error) {
+	t := p.next()
+	if t.kind != tokValue {
+		return nil, p.syntaxError(t)
+	}
+	v, ok := p.values[t.text]
+	if !ok {
+		return nil, fmt.Errorf("An expression attribute value used in expression is not defined; attribute value: %s", t.text)
+	}
+	p.usedValues[t.text] = true
+	return v, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokValue:
+		v, err := p.parseValueRef()
+		if err != nil {
+			return nil, err
+		}
+		return &valueOperand{v: v}, nil
+	case t.kind == tokIdent && strings.EqualFold(t.text, "size") && p.toks[p.pos+1].text == "(":
+		p.next()
+		p.next()
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return &sizeOperand{path: pth}, nil
+	case t.kind == tokIdent || t.kind == tokName:
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return &pathOperand{path: pth}, nil
+	}
+	return nil, p.syntaxError(t)
+}
+
+var conditionFuncs = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+func (p *parser) parseCondition() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orCond{a: left, b: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andCond{a: left, b: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notCond{c: c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.isPunct("(") {
+		p.next()
+		c, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	t := p.peek()
+	if t.kind == tokIdent && p.toks[p.pos+1].text == "(" {
+		name := strings.ToLower(t.text)
+		if arity, ok := conditionFuncs[name]; ok {
+			p.next()
+			p.next()
+			args := make([]operand, 0, arity)
+			for i := 0; i < arity; i++ {
+				if i > 0 {
+					if err := p.expectPunct(","); err != nil {
+						return nil, err
+					}
+				}
+				op, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, op)
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			if _, ok := args[0].(*pathOperand); !ok {
+				return nil, fmt.Errorf("Invalid ConditionExpression: Incorrect operand type for operator or function; operator or function: %s", name)
+			}
+			return &funcCond{name: name, args: args}, nil
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isKeyword("BETWEEN"):
+		p.next()
+		lo, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, p.syntaxError(p.peek())
+		}
+		p.next()
+		hi, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenCond{v: left, lo: lo, hi: hi}, nil
+	case p.isKeyword("IN"):
+		p.next()
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		var list []operand
+		for {
+			op, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, op)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return &inCond{v: left, list: list}, nil
+	}
+
+	t = p.next()
+	switch t.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+		if t.kind != tokPunct {
+			return nil, p.syntaxError(t)
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &compareCond{op: t.text, a: left, b: right}, nil
+	}
+	return nil, p.syntaxError(t)
+}
+
+func (p *parser) condition(s string) (condition, error) {
+	if err := p.reset(s); err != nil {
+		return nil, err
+	}
+	c, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.expectEOF()
+}
+
+func (p *parser) projection(s string) ([]path, error) {
+	if err := p.reset(s); err != nil {
+		return nil, err
+	}
+	var out []path
+	for {
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pth)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	return out, p.expectEOF()
+}
+
+func (p *parser) update(s string) (*updateExpr, error) {
+	if err := p.reset(s); err != nil {
+		return nil, err
+	}
+
+	u := &updateExpr{}
+	seen := map[string]bool{}
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		clause := strings.ToUpper(t.text)
+		if t.kind != tokIdent {
+			return nil, p.syntaxError(t)
+		}
+		if seen[clause] {
+			return nil, fmt.Errorf("The %q section can only be used once in an update expression;", clause)
+		}
+		seen[clause] = true
+
+		for {
+			switch clause {
+			case "SET":
+				pth, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct("="); err != nil {
+					return nil, err
+				}
+				v, err := p.parseSetValue()
+				if err != nil {
+					return nil, err
+				}
+				u.set = append(u.set, updateAction{path: pth, value: v})
+			case "REMOVE":
+				pth, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				u.remove = append(u.remove, pth)
+			case "ADD", "DELETE":
+				pth, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				v, err := p.parseValueRef()
+				if err != nil {
+					return nil, err
+				}
+				a := updateAction{path: pth, value: &valueOperand{v: v}}
+				if clause == "ADD" {
+					u.add = append(u.add, a)
+				} else {
+					u.delete = append(u.delete, a)
+				}
+			default:
+				return nil, p.syntaxError(t)
+			}
+
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("The expression can not be empty;")
+	}
+
+	var paths []path
+	for _, a := range u.set {
+		paths = append(paths, a.path)
+	}
+	paths = append(paths, u.remove...)
+	for _, a := range u.add {
+		paths = append(paths, a.path)
+	}
+	for _, a := range u.delete {
+		paths = append(paths, a.path)
+	}
+	for i := range paths {
+		for j := i + 1; j < len(paths); j++ {
+			if paths[i].overlaps(paths[j]) {
+				return nil, fmt.Errorf("Two document paths overlap with each other; must remove or rewrite one of these paths; path one: [%s], path two: [%s]", paths[i], paths[j])
+			}
+		}
+	}
+
+	return u, nil
+}
+
+func (p *parser) parseSetValue() (operand, error) {
+	a, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct("+") || p.isPunct("-") {
+		op := p.next().text
+		b, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &arithOperand{op: op, a: a, b: b}, nil
+	}
+	return a, nil
+}
+
+func (p *parser) parseSetOperand() (operand, error) {
+	t := p.peek()
+	if t.kind == tokIdent && p.toks[p.pos+1].text == "(" {
+		switch strings.ToLower(t.text) {
+		case "if_not_exists":
+			p.next()
+			p.next()
+			pth, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(","); err != nil {
+				return nil, err
+			}
+			def, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return &ifNotExistsOperand{path: pth, def: def}, nil
+		case "list_append":
+			p.next()
+			p.next()
+			a, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(","); err != nil {
+				return nil, err
+			}
+			b, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return &listAppendOperand{a: a, b: b}, nil
+		}
+	}
+
+	op, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := op.(*sizeOperand); ok {
+		return nil, fmt.Errorf("The function is not allowed in an update expression; function: size")
+	}
+	return op, nil
+}
+
+func sortedStrings(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
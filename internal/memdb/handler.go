@@ -0,0 +1,137 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+const targetPrefix = "DynamoDB_20120810."
+
+// ServeHTTP implements the DynamoDB JSON 1.0 protocol.
+func (db *DB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, newError("SerializationException", "%s", err).body())
+		return
+	}
+
+	op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), targetPrefix)
+	out, err := db.do(op, body)
+	if err == nil && mutates(op) {
+		err = db.persist()
+	}
+	if err != nil {
+		e, ok := err.(*apiError)
+		if !ok {
+			e = &apiError{code: "InternalServerError", message: err.Error(), status: http.StatusInternalServerError}
+		}
+		writeResponse(w, e.status, e.body())
+		return
+	}
+	writeResponse(w, http.StatusOK, out)
+}
+
+func writeResponse(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data = []byte(`{"__type":"com.amazonaws.dynamodb.v20120810#InternalServerError","message":"` + err.Error() + `"}`)
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE(data)), 10))
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// do runs a single DynamoDB operation, named as in the X-Amz-Target header
+// without its prefix, on a JSON request body.
+func (db *DB) do(op string, body []byte) (interface{}, error) {
+	switch op {
+	case "CreateTable":
+		var in createTableInput
+		return call(body, &in, func() (interface{}, error) { return db.createTable(&in) })
+	case "DeleteTable":
+		var in tableNameInput
+		return call(body, &in, func() (interface{}, error) { return db.deleteTable(&in) })
+	case "DescribeTable":
+		var in tableNameInput
+		return call(body, &in, func() (interface{}, error) { return db.describeTable(&in) })
+	case "UpdateTable":
+		var in updateTableInput
+		return call(body, &in, func() (interface{}, error) { return db.updateTable(&in) })
+	case "UpdateTimeToLive":
+		var in updateTimeToLiveInput
+		return call(body, &in, func() (interface{}, error) { return db.updateTimeToLive(&in) })
+	case "DescribeTimeToLive":
+		var in tableNameInput
+		return call(body, &in, func() (interface{}, error) { return db.describeTimeToLive(&in) })
+	case "ListTables":
+		var in listTablesInput
+		return call(body, &in, func() (interface{}, error) { return db.listTables(&in) })
+	case "PutItem":
+		var in putItemInput
+		return call(body, &in, func() (interface{}, error) { return db.putItem(&in) })
+	case "GetItem":
+		var in getItemInput
+		return call(body, &in, func() (interface{}, error) { return db.getItem(&in) })
+	case "DeleteItem":
+		var in deleteItemInput
+		return call(body, &in, func() (interface{}, error) { return db.deleteItem(&in) })
+	case "UpdateItem":
+		var in updateItemInput
+		return call(body, &in, func() (interface{}, error) { return db.updateItem(&in) })
+	case "Query":
+		var in queryInput
+		return call(body, &in, func() (interface{}, error) { return db.query(&in) })
+	case "Scan":
+		var in scanInput
+		return call(body, &in, func() (interface{}, error) { return db.scan(&in) })
+	case "BatchGetItem":
+		var in batchGetItemInput
+		return call(body, &in, func() (interface{}, error) { return db.batchGetItem(&in) })
+	case "BatchWriteItem":
+		var in batchWriteItemInput
+		return call(body, &in, func() (interface{}, error) { return db.batchWriteItem(&in) })
+	case "TransactWriteItems":
+		var in transactWriteItemsInput
+		return call(body, &in, func() (interface{}, error) { return db.transactWriteItems(&in) })
+	case "TransactGetItems":
+		var in transactGetItemsInput
+		return call(body, &in, func() (interface{}, error) { return db.transactGetItems(&in) })
+	}
+	return nil, newError("UnknownOperationException", "ddbmodeltest does not support operation %q", op)
+}
+
+func call(body []byte, in interface{}, fn func() (interface{}, error)) (interface{}, error) {
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, in); err != nil {
+			return nil, newError("SerializationException", "%s", err)
+		}
+	}
+	return fn()
+}
+
+// HTTPClient returns a client that serves every request from db, whatever
+// host the request is addressed to, through a server on the loopback
+// interface that the first call starts.
+//
+// The transport is a plain *http.Transport, since the SDKs insist on one
+// when a custom CA bundle is configured.
+func (db *DB) HTTPClient() *http.Client {
+	db.serveOnce.Do(func() {
+		db.server = httptest.NewServer(db)
+	})
+	addr := db.server.Listener.Addr().String()
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return &http.Client{Transport: &http.Transport{DialContext: dial}}
+}
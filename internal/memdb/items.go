@@ -0,0 +1,393 @@
+package memdb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// legacyParams are the pre-expression request parameters. ddbmodel never
+// sends them, so the fake rejects them rather than half-supporting them.
+type legacyParams struct {
+	AttributesToGet     json.RawMessage `json:",omitempty"`
+	AttributeUpdates    json.RawMessage `json:",omitempty"`
+	ConditionalOperator json.RawMessage `json:",omitempty"`
+	Expected            json.RawMessage `json:",omitempty"`
+	KeyConditions       json.RawMessage `json:",omitempty"`
+	QueryFilter         json.RawMessage `json:",omitempty"`
+	ScanFilter          json.RawMessage `json:",omitempty"`
+}
+
+func (l *legacyParams) check() error {
+	for name, raw := range map[string]json.RawMessage{
+		"AttributesToGet":     l.AttributesToGet,
+		"AttributeUpdates":    l.AttributeUpdates,
+		"ConditionalOperator": l.ConditionalOperator,
+		"Expected":            l.Expected,
+		"KeyConditions":       l.KeyConditions,
+		"QueryFilter":         l.QueryFilter,
+		"ScanFilter":          l.ScanFilter,
+	} {
+		if len(raw) > 0 && string(raw) != "null" {
+			return newError("ValidationException", "ddbmodeltest does not support the legacy parameter %s", name)
+		}
+	}
+	return nil
+}
+
+// exprParams are the placeholder maps shared by every expression of a request.
+type exprParams struct {
+	ExpressionAttributeNames  map[string]string `json:",omitempty"`
+	ExpressionAttributeValues map[string]*value `json:",omitempty"`
+}
+
+func (e *exprParams) parser() (*parser, error) {
+	for k, v := range e.ExpressionAttributeValues {
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("ExpressionAttributeValues contains invalid value: %s for key %s", err, k)
+		}
+	}
+	return newParser(e.ExpressionAttributeNames, e.ExpressionAttributeValues), nil
+}
+
+type writeCondition struct {
+	exprParams
+
+	ConditionExpression                 *string
+	ReturnValuesOnConditionCheckFailure string
+}
+
+// compile parses the optional condition. The caller must check for unused
+// placeholders once every expression of the request has been parsed.
+func (w *writeCondition) compile(p *parser) (condition, error) {
+	if w.ConditionExpression == nil {
+		return nil, nil
+	}
+	c, err := p.condition(*w.ConditionExpression)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ConditionExpression: %s", err)
+	}
+	return c, nil
+}
+
+func checkCondition(c condition, old item) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	return evalCondition(old, c)
+}
+
+func (db *DB) lockKey(table string, key string) string {
+	return table + "\x00" + key
+}
+
+type putItemInput struct {
+	legacyParams
+	writeCondition
+
+	TableName    string
+	Item         item
+	ReturnValues string
+}
+
+type attributesOutput struct {
+	Attributes item `json:",omitempty"`
+}
+
+func (db *DB) putItem(in *putItemInput) (*attributesOutput, error) {
+	if err := in.check(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	switch in.ReturnValues {
+	case "", "NONE", "ALL_OLD":
+	default:
+		return nil, newError("ValidationException", "ReturnValues can only be ALL_OLD or NONE")
+	}
+	if err := t.checkItem(in.Item); err != nil {
+		return nil, validationError(err)
+	}
+
+	p, err := in.parser()
+	if err != nil {
+		return nil, validationError(err)
+	}
+	cond, err := in.compile(p)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, validationError(err)
+	}
+
+	ks := t.keyString(t.keyOf(in.Item))
+	if db.locks[db.lockKey(t.desc.TableName, ks)] {
+		return nil, transactionConflict()
+	}
+	old := t.items[ks]
+	ok, err := checkCondition(cond, old)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if !ok {
+		return nil, conditionalCheckFailed(old, in.ReturnValuesOnConditionCheckFailure)
+	}
+
+	t.items[ks] = in.Item.clone()
+
+	out := &attributesOutput{}
+	if in.ReturnValues == "ALL_OLD" {
+		out.Attributes = old.clone()
+	}
+	return out, nil
+}
+
+type getItemInput struct {
+	legacyParams
+	exprParams
+
+	TableName            string
+	Key                  item
+	ConsistentRead       bool
+	ProjectionExpression *string
+}
+
+type getItemOutput struct {
+	Item item `json:",omitempty"`
+}
+
+func (db *DB) getItem(in *getItemInput) (*getItemOutput, error) {
+	if err := in.check(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkKey(in.Key); err != nil {
+		return nil, validationError(err)
+	}
+
+	p, err := in.parser()
+	if err != nil {
+		return nil, validationError(err)
+	}
+	var paths []path
+	if in.ProjectionExpression != nil {
+		if paths, err = p.projection(*in.ProjectionExpression); err != nil {
+			return nil, validationError(fmt.Errorf("Invalid ProjectionExpression: %s", err))
+		}
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, validationError(err)
+	}
+
+	out := &getItemOutput{}
+	if it, ok := t.items[t.keyString(in.Key)]; ok {
+		out.Item = project(it, paths)
+	}
+	return out, nil
+}
+
+type deleteItemInput struct {
+	legacyParams
+	writeCondition
+
+	TableName    string
+	Key          item
+	ReturnValues string
+}
+
+func (db *DB) deleteItem(in *deleteItemInput) (*attributesOutput, error) {
+	if err := in.check(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	switch in.ReturnValues {
+	case "", "NONE", "ALL_OLD":
+	default:
+		return nil, newError("ValidationException", "ReturnValues can only be ALL_OLD or NONE")
+	}
+	if err := t.checkKey(in.Key); err != nil {
+		return nil, validationError(err)
+	}
+
+	p, err := in.parser()
+	if err != nil {
+		return nil, validationError(err)
+	}
+	cond, err := in.compile(p)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, validationError(err)
+	}
+
+	ks := t.keyString(in.Key)
+	if db.locks[db.lockKey(t.desc.TableName, ks)] {
+		return nil, transactionConflict()
+	}
+	old := t.items[ks]
+	ok, err := checkCondition(cond, old)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if !ok {
+		return nil, conditionalCheckFailed(old, in.ReturnValuesOnConditionCheckFailure)
+	}
+
+	delete(t.items, ks)
+
+	out := &attributesOutput{}
+	if in.ReturnValues == "ALL_OLD" {
+		out.Attributes = old
+	}
+	return out, nil
+}
+
+type updateItemInput struct {
+	legacyParams
+	writeCondition
+
+	TableName        string
+	Key              item
+	UpdateExpression *string
+	ReturnValues     string
+}
+
+// compileUpdate parses an update expression and rejects changes to the key.
+func (t *table) compileUpdate(p *parser, expr *string) (*updateExpr, error) {
+	if expr == nil {
+		return &updateExpr{}, nil
+	}
+	u, err := p.update(*expr)
+	if err != nil {
+		if _, ok := err.(*evalError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Invalid UpdateExpression: %s", err)
+	}
+	for _, name := range u.updatedNames() {
+		if name == t.hashKey || name == t.rangeKey {
+			return nil, fmt.Errorf("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", name)
+		}
+	}
+	return u, nil
+}
+
+// applyUpdate computes the item an update produces. A missing item starts out
+// as just its key.
+func (t *table) applyUpdate(key item, old item, u *updateExpr) (item, error) {
+	base := old
+	if base == nil {
+		base = key.clone()
+	}
+	next, err := applyUpdate(base, u)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkItem(next); err != nil {
+		if err.Error() == "Item size has exceeded the maximum allowed size" {
+			return nil, fmt.Errorf("Item size to update has exceeded the maximum allowed size")
+		}
+		return nil, err
+	}
+	return next, nil
+}
+
+func (db *DB) updateItem(in *updateItemInput) (*attributesOutput, error) {
+	if err := in.check(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	switch in.ReturnValues {
+	case "", "NONE", "ALL_OLD", "UPDATED_OLD", "ALL_NEW", "UPDATED_NEW":
+	default:
+		return nil, newError("ValidationException", "1 validation error detected: Value '%s' at 'returnValues' failed to satisfy constraint: Member must satisfy enum value set: [ALL_NEW, UPDATED_OLD, ALL_OLD, NONE, UPDATED_NEW]", in.ReturnValues)
+	}
+	if err := t.checkKey(in.Key); err != nil {
+		return nil, validationError(err)
+	}
+
+	p, err := in.parser()
+	if err != nil {
+		return nil, validationError(err)
+	}
+	u, err := t.compileUpdate(p, in.UpdateExpression)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	cond, err := in.compile(p)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, validationError(err)
+	}
+
+	ks := t.keyString(in.Key)
+	if db.locks[db.lockKey(t.desc.TableName, ks)] {
+		return nil, transactionConflict()
+	}
+	old := t.items[ks]
+	ok, err := checkCondition(cond, old)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if !ok {
+		return nil, conditionalCheckFailed(old, in.ReturnValuesOnConditionCheckFailure)
+	}
+
+	next, err := t.applyUpdate(in.Key, old, u)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	t.items[ks] = next
+
+	out := &attributesOutput{}
+	switch in.ReturnValues {
+	case "ALL_OLD":
+		out.Attributes = old.clone()
+	case "ALL_NEW":
+		out.Attributes = next.clone()
+	case "UPDATED_OLD", "UPDATED_NEW":
+		src := next
+		if in.ReturnValues == "UPDATED_OLD" {
+			src = old
+		}
+		for _, name := range u.updatedNames() {
+			if v, ok := src[name]; ok {
+				if out.Attributes == nil {
+					out.Attributes = item{}
+				}
+				out.Attributes[name] = v.clone()
+			}
+		}
+	}
+	return out, nil
+}
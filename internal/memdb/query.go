@@ -0,0 +1,424 @@
+package memdb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// maxPageSize is the 1 MB of data a single Query or Scan evaluates at most.
+const maxPageSize = 1 << 20
+
+type readInput struct {
+	legacyParams
+	exprParams
+
+	TableName            string
+	IndexName            *string
+	Limit                int
+	ExclusiveStartKey    item
+	ConsistentRead       bool
+	ProjectionExpression *string
+	FilterExpression     *string
+	Select               string
+}
+
+type queryInput struct {
+	readInput
+
+	KeyConditionExpression *string
+	ScanIndexForward       *bool
+}
+
+type scanInput struct {
+	readInput
+
+	Segment       *int
+	TotalSegments *int
+}
+
+type readOutput struct {
+	Items            []item `json:",omitempty"`
+	Count            int
+	ScannedCount     int
+	LastEvaluatedKey item `json:",omitempty"`
+}
+
+// readPlan is a parsed Query or Scan request.
+type readPlan struct {
+	v      view
+	filter condition
+	paths  []path
+	count  bool
+}
+
+func (t *table) viewNamed(name *string) (view, error) {
+	if name == nil {
+		return t.view(nil), nil
+	}
+	idx, ok := t.indexes[*name]
+	if !ok {
+		return view{}, fmt.Errorf("The table does not have the specified index: %s", *name)
+	}
+	if idx.creating() {
+		return view{}, fmt.Errorf("Cannot read from backfilling global secondary index: %s", *name)
+	}
+	return t.view(idx), nil
+}
+
+// plan validates the parameters shared by Query and Scan. keyCondition is
+// parsed by the caller between the projection and the unused check.
+func (in *readInput) plan(t *table, p *parser) (*readPlan, error) {
+	v, err := t.viewNamed(in.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	if in.ConsistentRead && v.idx != nil && v.idx.global {
+		return nil, fmt.Errorf("Consistent reads are not supported on global secondary indexes")
+	}
+	if in.Limit < 0 {
+		return nil, fmt.Errorf("1 validation error detected: Value '%d' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1", in.Limit)
+	}
+
+	rp := &readPlan{v: v}
+	if in.FilterExpression != nil {
+		if rp.filter, err = p.condition(*in.FilterExpression); err != nil {
+			return nil, fmt.Errorf("Invalid FilterExpression: %s", err)
+		}
+	}
+	if in.ProjectionExpression != nil {
+		if rp.paths, err = p.projection(*in.ProjectionExpression); err != nil {
+			return nil, fmt.Errorf("Invalid ProjectionExpression: %s", err)
+		}
+	}
+
+	switch in.Select {
+	case "":
+	case "COUNT":
+		if in.ProjectionExpression != nil {
+			return nil, fmt.Errorf("Cannot specify the ProjectionExpression when choosing to get COUNT")
+		}
+		rp.count = true
+	case "SPECIFIC_ATTRIBUTES":
+		if in.ProjectionExpression == nil {
+			return nil, fmt.Errorf("SPECIFIC_ATTRIBUTES requires a ProjectionExpression")
+		}
+	case "ALL_ATTRIBUTES":
+		if in.ProjectionExpression != nil {
+			return nil, fmt.Errorf("Cannot specify the ProjectionExpression when choosing to get ALL_ATTRIBUTES")
+		}
+		if v.idx != nil && v.idx.global && v.idx.projection.ProjectionType != "ALL" {
+			return nil, fmt.Errorf("One or more parameter values were invalid: Select type ALL_ATTRIBUTES is not supported for global secondary index %s because its projection type is not ALL", v.idx.name)
+		}
+	case "ALL_PROJECTED_ATTRIBUTES":
+		if v.idx == nil {
+			return nil, fmt.Errorf("One or more parameter values were invalid: ALL_PROJECTED_ATTRIBUTES can be used only when Querying using an IndexName")
+		}
+		if in.ProjectionExpression != nil {
+			return nil, fmt.Errorf("Cannot specify the ProjectionExpression when choosing to get ALL_PROJECTED_ATTRIBUTES")
+		}
+	default:
+		return nil, fmt.Errorf("1 validation error detected: Value '%s' at 'select' failed to satisfy constraint: Member must satisfy enum value set: [SPECIFIC_ATTRIBUTES, COUNT, ALL_ATTRIBUTES, ALL_PROJECTED_ATTRIBUTES]", in.Select)
+	}
+
+	if in.ExclusiveStartKey != nil {
+		for _, n := range v.keyNames() {
+			if err := t.checkKeyValue(n, in.ExclusiveStartKey[n]); err != nil {
+				return nil, fmt.Errorf("The provided starting key is invalid: %s", err)
+			}
+		}
+	}
+
+	return rp, nil
+}
+
+// page evaluates the sorted candidates from ExclusiveStartKey onwards until
+// Limit or the page size is reached.
+func (rp *readPlan) page(in *readInput, candidates []item, forward bool) (*readOutput, error) {
+	start := 0
+	if esk := in.ExclusiveStartKey; esk != nil {
+		start = len(candidates)
+		for i, it := range candidates {
+			if (forward && rp.v.less(esk, it)) || (!forward && rp.v.less(it, esk)) {
+				start = i
+				break
+			}
+		}
+	}
+
+	out := &readOutput{}
+	size := 0
+	for i := start; i < len(candidates); i++ {
+		it := candidates[i]
+		out.ScannedCount++
+		size += it.size()
+
+		ok, err := checkCondition(rp.filter, it)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out.Count++
+			if !rp.count {
+				out.Items = append(out.Items, project(rp.v.projectItem(it), rp.paths))
+			}
+		}
+
+		limited := in.Limit > 0 && out.ScannedCount == in.Limit
+		if limited || (size >= maxPageSize && i < len(candidates)-1) {
+			out.LastEvaluatedKey = rp.v.lastKey(it)
+			break
+		}
+	}
+	return out, nil
+}
+
+func conditionPaths(c condition) []path {
+	var out []path
+	addOperand := func(op operand) {
+		switch o := op.(type) {
+		case *pathOperand:
+			out = append(out, o.path)
+		case *sizeOperand:
+			out = append(out, o.path)
+		}
+	}
+	switch c := c.(type) {
+	case *andCond:
+		out = append(append(out, conditionPaths(c.a)...), conditionPaths(c.b)...)
+	case *orCond:
+		out = append(append(out, conditionPaths(c.a)...), conditionPaths(c.b)...)
+	case *notCond:
+		out = append(out, conditionPaths(c.c)...)
+	case *compareCond:
+		addOperand(c.a)
+		addOperand(c.b)
+	case *betweenCond:
+		addOperand(c.v)
+		addOperand(c.lo)
+		addOperand(c.hi)
+	case *inCond:
+		addOperand(c.v)
+		for _, op := range c.list {
+			addOperand(op)
+		}
+	case *funcCond:
+		for _, op := range c.args {
+			addOperand(op)
+		}
+	}
+	return out
+}
+
+// splitKeyCondition checks that a key condition is an equality on the
+// partition key optionally AND-ed with one supported sort key condition.
+func splitKeyCondition(c condition, v view) (*value, condition, error) {
+	var terms []condition
+	var flatten func(c condition) error
+	flatten = func(c condition) error {
+		switch c := c.(type) {
+		case *andCond:
+			if err := flatten(c.a); err != nil {
+				return err
+			}
+			return flatten(c.b)
+		case *orCond:
+			return fmt.Errorf("Invalid operator used in KeyConditionExpression: OR")
+		case *notCond:
+			return fmt.Errorf("Invalid operator used in KeyConditionExpression: NOT")
+		case *inCond:
+			return fmt.Errorf("Invalid operator used in KeyConditionExpression: IN")
+		}
+		terms = append(terms, c)
+		return nil
+	}
+	if err := flatten(c); err != nil {
+		return nil, nil, err
+	}
+
+	keyName := func(op operand) (string, bool) {
+		po, ok := op.(*pathOperand)
+		if !ok || len(po.path) != 1 {
+			return "", false
+		}
+		return po.path[0].name, true
+	}
+
+	var hash *value
+	var rangeCond condition
+	for _, term := range terms {
+		var name string
+		var ok bool
+		switch t := term.(type) {
+		case *compareCond:
+			if name, ok = keyName(t.a); !ok {
+				return nil, nil, fmt.Errorf("Invalid KeyConditionExpression: The left hand side of a key condition must be an attribute name")
+			}
+			if _, isValue := t.b.(*valueOperand); !isValue {
+				return nil, nil, fmt.Errorf("Invalid KeyConditionExpression: The right hand side of a key condition must be a value")
+			}
+			if name == v.hashKey && t.op == "=" && hash == nil {
+				hash = t.b.(*valueOperand).v
+				continue
+			}
+			if t.op == "<>" {
+				return nil, nil, fmt.Errorf("Unsupported operator on KeyConditionExpression: operator: <>")
+			}
+		case *betweenCond:
+			name, ok = keyName(t.v)
+		case *funcCond:
+			if t.name != "begins_with" {
+				return nil, nil, fmt.Errorf("Invalid KeyConditionExpression: Invalid function name; function: %s", t.name)
+			}
+			name, ok = keyName(t.args[0])
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("Invalid KeyConditionExpression: Unsupported key condition")
+		}
+		if name != v.rangeKey || rangeCond != nil {
+			return nil, nil, fmt.Errorf("Query condition missed key schema element")
+		}
+		rangeCond = term
+	}
+
+	if hash == nil {
+		return nil, nil, fmt.Errorf("Query condition missed key schema element: %s", v.hashKey)
+	}
+	return hash, rangeCond, nil
+}
+
+func (db *DB) query(in *queryInput) (*readOutput, error) {
+	if err := in.check(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if in.KeyConditionExpression == nil {
+		return nil, newError("ValidationException", "Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+
+	p, err := in.parser()
+	if err != nil {
+		return nil, validationError(err)
+	}
+	rp, err := in.plan(t, p)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	kc, err := p.condition(*in.KeyConditionExpression)
+	if err != nil {
+		return nil, validationError(fmt.Errorf("Invalid KeyConditionExpression: %s", err))
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, validationError(err)
+	}
+
+	hash, rangeCond, err := splitKeyCondition(kc, rp.v)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	for _, pth := range conditionPaths(rp.filter) {
+		for _, n := range []string{rp.v.hashKey, rp.v.rangeKey} {
+			if pth[0].name == n {
+				return nil, newError("ValidationException", "Filter Expression can only contain non-primary key attributes: Primary key attribute: %s", n)
+			}
+		}
+	}
+
+	var candidates []item
+	for _, it := range t.items {
+		if !rp.v.contains(it) || !equal(it[rp.v.hashKey], hash) {
+			continue
+		}
+		ok, err := checkCondition(rangeCond, it)
+		if err != nil {
+			return nil, validationError(err)
+		}
+		if ok {
+			candidates = append(candidates, it)
+		}
+	}
+
+	forward := in.ScanIndexForward == nil || *in.ScanIndexForward
+	sort.Slice(candidates, func(i, j int) bool {
+		if forward {
+			return rp.v.less(candidates[i], candidates[j])
+		}
+		return rp.v.less(candidates[j], candidates[i])
+	})
+
+	out, err := rp.page(&in.readInput, candidates, forward)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	return out, nil
+}
+
+func segmentOf(it item, hashKey string, total int) int {
+	h := fnv.New32a()
+	h.Write([]byte(it[hashKey].keyString()))
+	return int(h.Sum32() % uint32(total))
+}
+
+func (db *DB) scan(in *scanInput) (*readOutput, error) {
+	if err := in.check(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if (in.Segment == nil) != (in.TotalSegments == nil) {
+		return nil, newError("ValidationException", "The Segment parameter is required but was not present in the request when parameter TotalSegments is present")
+	}
+	if in.TotalSegments != nil {
+		if *in.TotalSegments < 1 || *in.TotalSegments > 1000000 {
+			return nil, newError("ValidationException", "1 validation error detected: Value '%d' at 'totalSegments' failed to satisfy constraint: Member must have value less than or equal to 1000000", *in.TotalSegments)
+		}
+		if *in.Segment < 0 || *in.Segment >= *in.TotalSegments {
+			return nil, newError("ValidationException", "The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: %d is not less than TotalSegments: %d", *in.Segment, *in.TotalSegments)
+		}
+	}
+
+	p, err := in.parser()
+	if err != nil {
+		return nil, validationError(err)
+	}
+	rp, err := in.plan(t, p)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, validationError(err)
+	}
+
+	var candidates []item
+	for _, it := range t.items {
+		if !rp.v.contains(it) {
+			continue
+		}
+		if in.TotalSegments != nil && segmentOf(it, t.hashKey, *in.TotalSegments) != *in.Segment {
+			continue
+		}
+		candidates = append(candidates, it)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return rp.v.less(candidates[i], candidates[j])
+	})
+
+	out, err := rp.page(&in.readInput, candidates, true)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	return out, nil
+}
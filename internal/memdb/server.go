@@ -0,0 +1,41 @@
+package memdb
+
+import (
+	"net"
+	"net/http"
+)
+
+// Server serves a DB over HTTP, for SDK clients and tools that cannot use
+// an in-process client.
+type Server struct {
+	// URL is the endpoint to configure in clients, e.g. through
+	// AWS_ENDPOINT_URL_DYNAMODB.
+	URL string
+	DB  *DB
+
+	srv *http.Server
+}
+
+// NewServer starts serving db on addr. An empty addr picks a free port on
+// the loopback interface.
+func NewServer(db *DB, addr string) (*Server, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		URL: "http://" + ln.Addr().String(),
+		DB:  db,
+		srv: &http.Server{Handler: db},
+	}
+	go s.srv.Serve(ln)
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
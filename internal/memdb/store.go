@@ -0,0 +1,110 @@
+package memdb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type snapshotTable struct {
+	Table      tableDescription
+	TimeToLive *timeToLiveSpecification `json:",omitempty"`
+	Items      []item
+}
+
+// Open returns a DB backed by the file at path. The file is loaded when it
+// exists and rewritten after every operation that changes tables or items.
+func Open(path string) (*DB, error) {
+	db := New()
+	db.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot []snapshotTable
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	for _, st := range snapshot {
+		t, err := newTable(st.Table)
+		if err != nil {
+			return nil, err
+		}
+		t.ttl = st.TimeToLive
+		for _, it := range st.Items {
+			if err := t.checkItem(it); err != nil {
+				return nil, err
+			}
+			t.items[t.keyString(t.keyOf(it))] = it
+		}
+		db.tables[st.Table.TableName] = t
+	}
+	return db, nil
+}
+
+// mutates reports whether op can change the contents of a DB.
+func mutates(op string) bool {
+	switch op {
+	case "CreateTable", "DeleteTable", "UpdateTable", "UpdateTimeToLive",
+		"PutItem", "DeleteItem", "UpdateItem", "BatchWriteItem", "TransactWriteItems":
+		return true
+	}
+	return false
+}
+
+// persist writes the DB to its backing file, if it has one. The file is
+// replaced atomically so that a crash never leaves half a snapshot behind.
+func (db *DB) persist() error {
+	if db.path == "" {
+		return nil
+	}
+
+	db.persistMu.Lock()
+	defer db.persistMu.Unlock()
+
+	db.mu.Lock()
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snapshot := make([]snapshotTable, len(names))
+	for i, name := range names {
+		t := db.tables[name]
+		keys := make([]string, 0, len(t.items))
+		for ks := range t.items {
+			keys = append(keys, ks)
+		}
+		sort.Strings(keys)
+		st := snapshotTable{Table: t.desc, TimeToLive: t.ttl, Items: make([]item, len(keys))}
+		for j, ks := range keys {
+			st.Items[j] = t.items[ks]
+		}
+		snapshot[i] = st
+	}
+	data, err := json.Marshal(snapshot)
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
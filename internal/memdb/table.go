@@ -0,0 +1,419 @@
+package memdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type attributeDefinition struct {
+	AttributeName string
+	AttributeType string
+}
+
+type keySchemaElement struct {
+	AttributeName string
+	KeyType       string
+}
+
+type projection struct {
+	ProjectionType   string   `json:",omitempty"`
+	NonKeyAttributes []string `json:",omitempty"`
+}
+
+type provisionedThroughput struct {
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+}
+
+type streamSpecification struct {
+	StreamEnabled  bool
+	StreamViewType string `json:",omitempty"`
+}
+
+type billingModeSummary struct {
+	BillingMode string
+}
+
+type indexDescription struct {
+	IndexName             string
+	KeySchema             []keySchemaElement
+	Projection            projection
+	IndexStatus           string                 `json:",omitempty"`
+	Backfilling           bool                   `json:",omitempty"`
+	ProvisionedThroughput *provisionedThroughput `json:",omitempty"`
+	IndexArn              string                 `json:",omitempty"`
+	ItemCount             int64
+	IndexSizeBytes        int64
+}
+
+type tableDescription struct {
+	TableName              string
+	TableArn               string
+	TableId                string
+	TableStatus            string
+	CreationDateTime       float64
+	AttributeDefinitions   []attributeDefinition
+	KeySchema              []keySchemaElement
+	GlobalSecondaryIndexes []indexDescription     `json:",omitempty"`
+	LocalSecondaryIndexes  []indexDescription     `json:",omitempty"`
+	BillingModeSummary     *billingModeSummary    `json:",omitempty"`
+	ProvisionedThroughput  *provisionedThroughput `json:",omitempty"`
+	StreamSpecification    *streamSpecification   `json:",omitempty"`
+	LatestStreamArn        string                 `json:",omitempty"`
+	LatestStreamLabel      string                 `json:",omitempty"`
+	ItemCount              int64
+	TableSizeBytes         int64
+}
+
+type index struct {
+	name       string
+	global     bool
+	hashKey    string
+	rangeKey   string
+	projection projection
+	// activeAt is when a global index that UpdateTable adds is done
+	// backfilling.
+	activeAt time.Time
+}
+
+func (idx *index) creating() bool {
+	return time.Now().Before(idx.activeAt)
+}
+
+type table struct {
+	desc      tableDescription
+	attrTypes map[string]string
+	hashKey   string
+	rangeKey  string
+	indexes   map[string]*index
+	items     map[string]item
+	ttl       *timeToLiveSpecification
+}
+
+func splitKeySchema(ks []keySchemaElement) (hash, rng string, err error) {
+	for _, k := range ks {
+		switch k.KeyType {
+		case "HASH":
+			if hash != "" {
+				return "", "", fmt.Errorf("Invalid KeySchema: Some index key attribute have no definition")
+			}
+			hash = k.AttributeName
+		case "RANGE":
+			if rng != "" {
+				return "", "", fmt.Errorf("Invalid KeySchema: Some index key attribute have no definition")
+			}
+			rng = k.AttributeName
+		default:
+			return "", "", fmt.Errorf("1 validation error detected: Value '%s' at 'keySchema.member.keyType' failed to satisfy constraint: Member must satisfy enum value set: [HASH, RANGE]", k.KeyType)
+		}
+	}
+	if hash == "" {
+		return "", "", fmt.Errorf("Invalid KeySchema: The first KeySchemaElement is not a HASH key type")
+	}
+	return hash, rng, nil
+}
+
+func newTable(desc tableDescription) (*table, error) {
+	t := &table{
+		desc:      desc,
+		attrTypes: map[string]string{},
+		indexes:   map[string]*index{},
+		items:     map[string]item{},
+	}
+
+	for _, d := range desc.AttributeDefinitions {
+		switch d.AttributeType {
+		case "S", "N", "B":
+		default:
+			return nil, fmt.Errorf("1 validation error detected: Value '%s' at 'attributeDefinitions.member.attributeType' failed to satisfy constraint: Member must satisfy enum value set: [B, N, S]", d.AttributeType)
+		}
+		t.attrTypes[d.AttributeName] = d.AttributeType
+	}
+
+	var err error
+	t.hashKey, t.rangeKey, err = splitKeySchema(desc.KeySchema)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	checkKeys := func(names ...string) error {
+		for _, n := range names {
+			if n == "" {
+				continue
+			}
+			if _, ok := t.attrTypes[n]; !ok {
+				return fmt.Errorf("One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions. Keys: [%s], AttributeDefinitions: [%s]", n, strings.Join(sortedStrings(t.attrTypes), ", "))
+			}
+			used[n] = true
+		}
+		return nil
+	}
+	if err := checkKeys(t.hashKey, t.rangeKey); err != nil {
+		return nil, err
+	}
+
+	for i := range desc.GlobalSecondaryIndexes {
+		if err := t.addIndex(&desc.GlobalSecondaryIndexes[i], true); err != nil {
+			return nil, err
+		}
+	}
+	for i := range desc.LocalSecondaryIndexes {
+		if err := t.addIndex(&desc.LocalSecondaryIndexes[i], false); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range t.indexes {
+		if err := checkKeys(idx.hashKey, idx.rangeKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(used) != len(t.attrTypes) {
+		return nil, fmt.Errorf("One or more parameter values were invalid: Number of attributes in KeySchema does not exactly match number of attributes defined in AttributeDefinitions")
+	}
+
+	return t, nil
+}
+
+func (t *table) addIndex(d *indexDescription, global bool) error {
+	if d.IndexName == "" {
+		return fmt.Errorf("One or more parameter values were invalid: Index name must be specified")
+	}
+	if _, ok := t.indexes[d.IndexName]; ok {
+		return fmt.Errorf("One or more parameter values were invalid: Duplicate index name: %s", d.IndexName)
+	}
+
+	hash, rng, err := splitKeySchema(d.KeySchema)
+	if err != nil {
+		return err
+	}
+	if !global {
+		if hash != t.hashKey || rng == "" {
+			return fmt.Errorf("One or more parameter values were invalid: Index KeySchema does not have the same leading hash key as table KeySchema for index: %s", d.IndexName)
+		}
+	}
+
+	switch d.Projection.ProjectionType {
+	case "":
+		d.Projection.ProjectionType = "ALL"
+	case "ALL", "KEYS_ONLY":
+		if len(d.Projection.NonKeyAttributes) > 0 {
+			return fmt.Errorf("One or more parameter values were invalid: ProjectionType is %s, but NonKeyAttributes is specified", d.Projection.ProjectionType)
+		}
+	case "INCLUDE":
+	default:
+		return fmt.Errorf("1 validation error detected: Value '%s' at 'projection.projectionType' failed to satisfy constraint: Member must satisfy enum value set: [ALL, INCLUDE, KEYS_ONLY]", d.Projection.ProjectionType)
+	}
+
+	if global {
+		d.IndexStatus = "ACTIVE"
+	}
+	d.IndexArn = t.desc.TableArn + "/index/" + d.IndexName
+
+	t.indexes[d.IndexName] = &index{
+		name:       d.IndexName,
+		global:     global,
+		hashKey:    hash,
+		rangeKey:   rng,
+		projection: d.Projection,
+	}
+	return nil
+}
+
+func (t *table) describe() tableDescription {
+	desc := t.desc
+	desc.ItemCount = int64(len(t.items))
+	desc.TableSizeBytes = 0
+	for _, it := range t.items {
+		desc.TableSizeBytes += int64(it.size())
+	}
+
+	count := func(list []indexDescription) []indexDescription {
+		out := make([]indexDescription, len(list))
+		for i, d := range list {
+			v := t.view(t.indexes[d.IndexName])
+			if v.idx.creating() {
+				d.IndexStatus, d.Backfilling = "CREATING", true
+			}
+			d.ItemCount, d.IndexSizeBytes = 0, 0
+			for _, it := range t.items {
+				if v.contains(it) {
+					d.ItemCount++
+					d.IndexSizeBytes += int64(v.projectItem(it).size())
+				}
+			}
+			out[i] = d
+		}
+		return out
+	}
+	desc.GlobalSecondaryIndexes = count(desc.GlobalSecondaryIndexes)
+	desc.LocalSecondaryIndexes = count(desc.LocalSecondaryIndexes)
+	return desc
+}
+
+var errKeyMismatch = fmt.Errorf("The provided key element does not match the schema")
+
+// checkKeyValue validates a key attribute against its declared type.
+func (t *table) checkKeyValue(name string, v *value) error {
+	if v == nil || v.typ != t.attrTypes[name] {
+		return errKeyMismatch
+	}
+	if (v.typ == "S" && v.s == "") || (v.typ == "B" && len(v.b) == 0) {
+		return fmt.Errorf("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %s", name)
+	}
+	return v.validate()
+}
+
+// checkKey validates a Key parameter: exactly the primary key attributes.
+func (t *table) checkKey(key item) error {
+	want := 1
+	if t.rangeKey != "" {
+		want = 2
+	}
+	if len(key) != want {
+		return errKeyMismatch
+	}
+	if err := t.checkKeyValue(t.hashKey, key[t.hashKey]); err != nil {
+		return err
+	}
+	if t.rangeKey != "" {
+		return t.checkKeyValue(t.rangeKey, key[t.rangeKey])
+	}
+	return nil
+}
+
+func (t *table) checkItem(it item) error {
+	for _, name := range []string{t.hashKey, t.rangeKey} {
+		if name == "" {
+			continue
+		}
+		v, ok := it[name]
+		if !ok {
+			return fmt.Errorf("One or more parameter values were invalid: Missing the key %s in the item", name)
+		}
+		if v.typ != t.attrTypes[name] {
+			return fmt.Errorf("One or more parameter values were invalid: Type mismatch for key %s expected: %s actual: %s", name, t.attrTypes[name], v.typ)
+		}
+		if err := t.checkKeyValue(name, v); err != nil {
+			return err
+		}
+	}
+
+	for _, idx := range t.indexes {
+		for _, name := range []string{idx.hashKey, idx.rangeKey} {
+			if v, ok := it[name]; ok && name != "" && v.typ != t.attrTypes[name] {
+				return fmt.Errorf("One or more parameter values were invalid: Type mismatch for Index Key %s Expected: %s Actual: %s IndexName: %s", name, t.attrTypes[name], v.typ, idx.name)
+			}
+		}
+	}
+
+	for _, v := range it {
+		if err := v.validate(); err != nil {
+			return err
+		}
+	}
+
+	if it.size() > maxItemSize {
+		return fmt.Errorf("Item size has exceeded the maximum allowed size")
+	}
+	return nil
+}
+
+const maxItemSize = 400 * 1024
+
+func (t *table) keyOf(it item) item {
+	key := item{t.hashKey: it[t.hashKey]}
+	if t.rangeKey != "" {
+		key[t.rangeKey] = it[t.rangeKey]
+	}
+	return key
+}
+
+func (t *table) keyString(key item) string {
+	s := key[t.hashKey].keyString()
+	if t.rangeKey != "" {
+		s += "\x00" + key[t.rangeKey].keyString()
+	}
+	return s
+}
+
+// view is the table or one of its indexes, as read by Query and Scan.
+type view struct {
+	t        *table
+	idx      *index
+	hashKey  string
+	rangeKey string
+}
+
+func (t *table) view(idx *index) view {
+	if idx == nil {
+		return view{t: t, hashKey: t.hashKey, rangeKey: t.rangeKey}
+	}
+	return view{t: t, idx: idx, hashKey: idx.hashKey, rangeKey: idx.rangeKey}
+}
+
+// contains reports whether an item appears in a (possibly sparse) index.
+func (v view) contains(it item) bool {
+	if _, ok := it[v.hashKey]; !ok {
+		return false
+	}
+	if v.rangeKey != "" {
+		if _, ok := it[v.rangeKey]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// keyNames lists the attributes that make up LastEvaluatedKey for the view.
+func (v view) keyNames() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, n := range []string{v.t.hashKey, v.t.rangeKey, v.hashKey, v.rangeKey} {
+		if n != "" && !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (v view) lastKey(it item) item {
+	key := item{}
+	for _, n := range v.keyNames() {
+		key[n] = it[n].clone()
+	}
+	return key
+}
+
+func (v view) projectItem(it item) item {
+	if v.idx == nil || v.idx.projection.ProjectionType == "ALL" {
+		return it.clone()
+	}
+	out := item{}
+	for _, n := range v.keyNames() {
+		out[n] = it[n].clone()
+	}
+	for _, n := range v.idx.projection.NonKeyAttributes {
+		if a, ok := it[n]; ok {
+			out[n] = a.clone()
+		}
+	}
+	return out
+}
+
+// less orders items by partition key, then sort key, then primary key, which
+// is stable across calls and therefore safe for ExclusiveStartKey paging.
+func (v view) less(a, b item) bool {
+	if ha, hb := a[v.hashKey].keyString(), b[v.hashKey].keyString(); ha != hb {
+		return ha < hb
+	}
+	if v.rangeKey != "" {
+		if n, ok := compare(a[v.rangeKey], b[v.rangeKey]); ok && n != 0 {
+			return n < 0
+		}
+	}
+	return v.t.keyString(a) < v.t.keyString(b)
+}
@@ -0,0 +1,213 @@
+package memdb
+
+import (
+	"fmt"
+	"time"
+)
+
+type updateTableInput struct {
+	TableName                   string
+	AttributeDefinitions        []attributeDefinition
+	GlobalSecondaryIndexUpdates []globalSecondaryIndexUpdate
+}
+
+type globalSecondaryIndexUpdate struct {
+	Create *indexDescription
+	Delete *struct{ IndexName string }
+	Update *struct{ IndexName string }
+}
+
+// updateTable creates or deletes a global secondary index, the only
+// changes to a table that ddbmodeltest supports. As with DynamoDB, a call
+// changes one index, and none while another is being created.
+func (db *DB) updateTable(in *updateTableInput) (*tableDescriptionOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(in.GlobalSecondaryIndexUpdates) {
+	case 0:
+		return nil, newError("ValidationException", "ddbmodeltest only supports GlobalSecondaryIndexUpdates in UpdateTable")
+	case 1:
+	default:
+		return nil, newError("LimitExceededException", "Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table")
+	}
+	for _, idx := range t.indexes {
+		if idx.creating() {
+			return nil, newError("LimitExceededException", "Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table")
+		}
+	}
+
+	desc := t.desc
+	desc.GlobalSecondaryIndexes = append([]indexDescription{}, t.desc.GlobalSecondaryIndexes...)
+	desc.LocalSecondaryIndexes = append([]indexDescription{}, t.desc.LocalSecondaryIndexes...)
+
+	u := in.GlobalSecondaryIndexUpdates[0]
+	var created string
+	switch {
+	case u.Create != nil:
+		if _, ok := t.indexes[u.Create.IndexName]; ok {
+			return nil, newError("ValidationException", "One or more parameter values were invalid: Index %s already exists", u.Create.IndexName)
+		}
+		desc.AttributeDefinitions, err = mergeAttributes(desc.AttributeDefinitions, in.AttributeDefinitions)
+		if err != nil {
+			return nil, validationError(err)
+		}
+		created = u.Create.IndexName
+		desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes, indexDescription{
+			IndexName:  u.Create.IndexName,
+			KeySchema:  u.Create.KeySchema,
+			Projection: u.Create.Projection,
+		})
+	case u.Delete != nil:
+		idx, ok := t.indexes[u.Delete.IndexName]
+		if !ok || !idx.global {
+			return nil, newError("ResourceNotFoundException", "Requested resource not found: Index %s does not exist", u.Delete.IndexName)
+		}
+		for i, d := range desc.GlobalSecondaryIndexes {
+			if d.IndexName == u.Delete.IndexName {
+				desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes[:i], desc.GlobalSecondaryIndexes[i+1:]...)
+				break
+			}
+		}
+		desc.AttributeDefinitions = usedAttributes(desc)
+	default:
+		return nil, newError("ValidationException", "ddbmodeltest does not support updating index settings")
+	}
+
+	nt, err := newTable(desc)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	nt.items = t.items
+	nt.ttl = t.ttl
+	if created != "" {
+		nt.indexes[created].activeAt = time.Now().Add(db.IndexCreationDelay)
+		for _, it := range nt.items {
+			if err := nt.checkItem(it); err != nil {
+				return nil, validationError(err)
+			}
+		}
+	}
+	db.tables[in.TableName] = nt
+
+	return &tableDescriptionOutput{TableDescription: nt.describe()}, nil
+}
+
+// mergeAttributes adds the definitions of more to defs, which must agree
+// on the attributes they both define.
+func mergeAttributes(defs, more []attributeDefinition) ([]attributeDefinition, error) {
+	out := append([]attributeDefinition{}, defs...)
+next:
+	for _, m := range more {
+		for _, d := range defs {
+			if d.AttributeName != m.AttributeName {
+				continue
+			}
+			if d.AttributeType != m.AttributeType {
+				return nil, fmt.Errorf("One or more parameter values were invalid: Cannot change the type of attribute %s", m.AttributeName)
+			}
+			continue next
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// usedAttributes keeps the attribute definitions of desc that a key of the
+// table or of one of its indexes still uses.
+func usedAttributes(desc tableDescription) []attributeDefinition {
+	used := map[string]bool{}
+	for _, k := range desc.KeySchema {
+		used[k.AttributeName] = true
+	}
+	for _, list := range [][]indexDescription{desc.GlobalSecondaryIndexes, desc.LocalSecondaryIndexes} {
+		for _, d := range list {
+			for _, k := range d.KeySchema {
+				used[k.AttributeName] = true
+			}
+		}
+	}
+
+	var out []attributeDefinition
+	for _, d := range desc.AttributeDefinitions {
+		if used[d.AttributeName] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+type timeToLiveSpecification struct {
+	AttributeName string
+	Enabled       bool
+}
+
+type updateTimeToLiveInput struct {
+	TableName               string
+	TimeToLiveSpecification timeToLiveSpecification
+}
+
+type updateTimeToLiveOutput struct {
+	TimeToLiveSpecification timeToLiveSpecification
+}
+
+// updateTimeToLive records the TTL attribute of a table. ddbmodeltest does
+// not expire items; DynamoDB itself only gets to them within days.
+func (db *DB) updateTimeToLive(in *updateTimeToLiveInput) (*updateTimeToLiveOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	spec := in.TimeToLiveSpecification
+	if spec.AttributeName == "" {
+		return nil, newError("ValidationException", "1 validation error detected: Value null at 'timeToLiveSpecification.attributeName' failed to satisfy constraint: Member must not be null")
+	}
+
+	switch enabled := t.ttl != nil; {
+	case spec.Enabled && enabled:
+		return nil, newError("ValidationException", "TimeToLive is already enabled")
+	case !spec.Enabled && !enabled:
+		return nil, newError("ValidationException", "TimeToLive is already disabled")
+	case !spec.Enabled && spec.AttributeName != t.ttl.AttributeName:
+		return nil, newError("ValidationException", "TimeToLive is active on a different AttributeName: current AttributeName is %s", t.ttl.AttributeName)
+	}
+
+	if spec.Enabled {
+		t.ttl = &spec
+	} else {
+		t.ttl = nil
+	}
+	return &updateTimeToLiveOutput{TimeToLiveSpecification: spec}, nil
+}
+
+type timeToLiveDescription struct {
+	TimeToLiveStatus string
+	AttributeName    string `json:",omitempty"`
+}
+
+type describeTimeToLiveOutput struct {
+	TimeToLiveDescription timeToLiveDescription
+}
+
+func (db *DB) describeTimeToLive(in *tableNameInput) (*describeTimeToLiveOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	out := &describeTimeToLiveOutput{TimeToLiveDescription: timeToLiveDescription{TimeToLiveStatus: "DISABLED"}}
+	if t.ttl != nil {
+		out.TimeToLiveDescription = timeToLiveDescription{TimeToLiveStatus: "ENABLED", AttributeName: t.ttl.AttributeName}
+	}
+	return out, nil
+}
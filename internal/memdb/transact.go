@@ -0,0 +1,350 @@
+package memdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	maxTransactItems = 100
+	tokenLifetime    = 10 * time.Minute
+)
+
+type tokenEntry struct {
+	request []byte
+	expires time.Time
+}
+
+type conditionCheck struct {
+	writeCondition
+
+	TableName string
+	Key       item
+}
+
+type transactPut struct {
+	writeCondition
+
+	TableName string
+	Item      item
+}
+
+type transactDelete struct {
+	writeCondition
+
+	TableName string
+	Key       item
+}
+
+type transactUpdate struct {
+	writeCondition
+
+	TableName        string
+	Key              item
+	UpdateExpression *string
+}
+
+type transactWriteItem struct {
+	ConditionCheck *conditionCheck
+	Put            *transactPut
+	Delete         *transactDelete
+	Update         *transactUpdate
+}
+
+type transactWriteItemsInput struct {
+	TransactItems      []transactWriteItem
+	ClientRequestToken string
+}
+
+type emptyOutput struct{}
+
+// transactAction is one validated action of a transaction.
+type transactAction struct {
+	t    *table
+	ks   string
+	cond condition
+	cw   *writeCondition
+
+	// next is the item to store, nil to delete; check actions do not write.
+	next  item
+	write bool
+
+	put    item
+	update *updateExpr
+	key    item
+}
+
+func (db *DB) compileTransactItem(ti transactWriteItem) (*transactAction, error) {
+	var (
+		tableName string
+		cw        *writeCondition
+		key       item
+		a         = &transactAction{}
+		n         int
+	)
+	if c := ti.ConditionCheck; c != nil {
+		n++
+		tableName, cw, key = c.TableName, &c.writeCondition, c.Key
+		if c.ConditionExpression == nil {
+			return nil, fmt.Errorf("The ConditionCheck action requires a ConditionExpression")
+		}
+	}
+	if p := ti.Put; p != nil {
+		n++
+		tableName, cw = p.TableName, &p.writeCondition
+		a.put, a.write = p.Item, true
+	}
+	if d := ti.Delete; d != nil {
+		n++
+		tableName, cw, key = d.TableName, &d.writeCondition, d.Key
+		a.write = true
+	}
+	if u := ti.Update; u != nil {
+		n++
+		tableName, cw, key = u.TableName, &u.writeCondition, u.Key
+		a.write = true
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("TransactItems can only contain one of Check, Put, Update or Delete")
+	}
+
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	a.t, a.cw = t, cw
+
+	p, err := cw.parser()
+	if err != nil {
+		return nil, err
+	}
+	if a.put != nil {
+		if err := t.checkItem(a.put); err != nil {
+			return nil, err
+		}
+		key = t.keyOf(a.put)
+	} else if err := t.checkKey(key); err != nil {
+		return nil, err
+	}
+	if u := ti.Update; u != nil {
+		if a.update, err = t.compileUpdate(p, u.UpdateExpression); err != nil {
+			return nil, err
+		}
+	}
+	if a.cond, err = cw.compile(p); err != nil {
+		return nil, err
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, err
+	}
+
+	a.key = key
+	a.ks = t.keyString(key)
+	return a, nil
+}
+
+func (db *DB) transactWriteItems(in *transactWriteItemsInput) (*emptyOutput, error) {
+	if len(in.TransactItems) == 0 || len(in.TransactItems) > maxTransactItems {
+		return nil, newError("ValidationException", "1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to %d", maxTransactItems)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	request, _ := json.Marshal(in.TransactItems)
+	if in.ClientRequestToken != "" {
+		if e, ok := db.tokens[in.ClientRequestToken]; ok && time.Now().Before(e.expires) {
+			if !bytes.Equal(e.request, request) {
+				return nil, newError("IdempotentParameterMismatchException", "Request parameters do not match the original request for client request token %s", in.ClientRequestToken)
+			}
+			return &emptyOutput{}, nil
+		}
+	}
+
+	actions := make([]*transactAction, len(in.TransactItems))
+	seen := map[string]bool{}
+	for i, ti := range in.TransactItems {
+		a, err := db.compileTransactItem(ti)
+		if err != nil {
+			return nil, validationError(err)
+		}
+		lk := db.lockKey(a.t.desc.TableName, a.ks)
+		if seen[lk] {
+			return nil, newError("ValidationException", "Transaction request cannot include multiple operations on one item")
+		}
+		seen[lk] = true
+		actions[i] = a
+	}
+
+	reasons := make([]cancellationReason, len(actions))
+	canceled := false
+	for i, a := range actions {
+		reasons[i].Code = "None"
+		if db.locks[db.lockKey(a.t.desc.TableName, a.ks)] {
+			reasons[i] = cancellationReason{Code: "TransactionConflict", Message: "Transaction is ongoing for the item"}
+			canceled = true
+			continue
+		}
+
+		old := a.t.items[a.ks]
+		ok, err := checkCondition(a.cond, old)
+		if err != nil {
+			return nil, validationError(err)
+		}
+		if !ok {
+			reasons[i] = cancellationReason{Code: "ConditionalCheckFailed", Message: "The conditional request failed"}
+			if a.cw.ReturnValuesOnConditionCheckFailure == "ALL_OLD" && old != nil {
+				reasons[i].Item = old.clone()
+			}
+			canceled = true
+			continue
+		}
+
+		switch {
+		case a.put != nil:
+			a.next = a.put.clone()
+		case a.update != nil:
+			next, err := a.t.applyUpdate(a.key, old, a.update)
+			if err != nil {
+				reasons[i] = cancellationReason{Code: "ValidationError", Message: err.Error()}
+				canceled = true
+				continue
+			}
+			a.next = next
+		}
+	}
+
+	if canceled {
+		codes := make([]string, len(reasons))
+		for i, r := range reasons {
+			codes[i] = r.Code
+		}
+		e := newError("TransactionCanceledException", "Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))
+		e.reasons = reasons
+		return nil, e
+	}
+
+	if db.TransactionDelay > 0 {
+		for _, a := range actions {
+			db.locks[db.lockKey(a.t.desc.TableName, a.ks)] = true
+		}
+		db.mu.Unlock()
+		time.Sleep(db.TransactionDelay)
+		db.mu.Lock()
+		for _, a := range actions {
+			delete(db.locks, db.lockKey(a.t.desc.TableName, a.ks))
+		}
+	}
+
+	for _, a := range actions {
+		if !a.write {
+			continue
+		}
+		if a.next == nil {
+			delete(a.t.items, a.ks)
+		} else {
+			a.t.items[a.ks] = a.next
+		}
+	}
+
+	if in.ClientRequestToken != "" {
+		db.tokens[in.ClientRequestToken] = tokenEntry{request: request, expires: time.Now().Add(tokenLifetime)}
+	}
+	return &emptyOutput{}, nil
+}
+
+type transactGet struct {
+	exprParams
+
+	TableName            string
+	Key                  item
+	ProjectionExpression *string
+}
+
+type transactGetItem struct {
+	Get *transactGet
+}
+
+type transactGetItemsInput struct {
+	TransactItems []transactGetItem
+}
+
+type itemResponse struct {
+	Item item `json:",omitempty"`
+}
+
+type transactGetItemsOutput struct {
+	Responses []itemResponse
+}
+
+func (db *DB) transactGetItems(in *transactGetItemsInput) (*transactGetItemsOutput, error) {
+	if len(in.TransactItems) == 0 || len(in.TransactItems) > maxTransactItems {
+		return nil, newError("ValidationException", "1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to %d", maxTransactItems)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	out := &transactGetItemsOutput{Responses: make([]itemResponse, len(in.TransactItems))}
+	reasons := make([]cancellationReason, len(in.TransactItems))
+	canceled := false
+	seen := map[string]bool{}
+	for i, ti := range in.TransactItems {
+		g := ti.Get
+		if g == nil {
+			return nil, newError("ValidationException", "TransactItems can only contain Get")
+		}
+		t, err := db.table(g.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.checkKey(g.Key); err != nil {
+			return nil, validationError(err)
+		}
+
+		p, err := g.parser()
+		if err != nil {
+			return nil, validationError(err)
+		}
+		var paths []path
+		if g.ProjectionExpression != nil {
+			if paths, err = p.projection(*g.ProjectionExpression); err != nil {
+				return nil, validationError(fmt.Errorf("Invalid ProjectionExpression: %s", err))
+			}
+		}
+		if err := p.checkUnused(); err != nil {
+			return nil, validationError(err)
+		}
+
+		ks := t.keyString(g.Key)
+		lk := db.lockKey(t.desc.TableName, ks)
+		if seen[lk] {
+			return nil, newError("ValidationException", "Transaction request cannot include multiple operations on one item")
+		}
+		seen[lk] = true
+
+		reasons[i].Code = "None"
+		if db.locks[lk] {
+			reasons[i] = cancellationReason{Code: "TransactionConflict", Message: "Transaction is ongoing for the item"}
+			canceled = true
+			continue
+		}
+		if it, ok := t.items[ks]; ok {
+			out.Responses[i].Item = project(it, paths)
+		}
+	}
+
+	if canceled {
+		codes := make([]string, len(reasons))
+		for i, r := range reasons {
+			codes[i] = r.Code
+		}
+		e := newError("TransactionCanceledException", "Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))
+		e.reasons = reasons
+		return nil, e
+	}
+	return out, nil
+}
@@ -0,0 +1,401 @@
+package memdb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// value is a DynamoDB attribute value in its wire form. Exactly one of the
+// members is meaningful, as selected by typ.
+type value struct {
+	typ  string
+	s    string // S and N
+	b    []byte
+	set  []string // SS and NS
+	bs   [][]byte
+	m    map[string]*value
+	l    []*value
+	bool bool // BOOL and NULL
+}
+
+type item map[string]*value
+
+func (v *value) MarshalJSON() ([]byte, error) {
+	var inner interface{}
+	switch v.typ {
+	case "S", "N":
+		inner = v.s
+	case "B":
+		inner = v.b
+	case "SS", "NS":
+		inner = v.set
+	case "BS":
+		inner = v.bs
+	case "M":
+		m := v.m
+		if m == nil {
+			m = map[string]*value{}
+		}
+		inner = m
+	case "L":
+		l := v.l
+		if l == nil {
+			l = []*value{}
+		}
+		inner = l
+	case "BOOL", "NULL":
+		inner = v.bool
+	default:
+		return nil, fmt.Errorf("invalid attribute value type %q", v.typ)
+	}
+	return json.Marshal(map[string]interface{}{v.typ: inner})
+}
+
+func (v *value) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	found := 0
+	for typ, msg := range raw {
+		if string(msg) == "null" {
+			continue
+		}
+		found++
+		v.typ = typ
+
+		var err error
+		switch typ {
+		case "S", "N":
+			err = json.Unmarshal(msg, &v.s)
+		case "B":
+			err = json.Unmarshal(msg, &v.b)
+		case "SS", "NS":
+			err = json.Unmarshal(msg, &v.set)
+		case "BS":
+			err = json.Unmarshal(msg, &v.bs)
+		case "M":
+			err = json.Unmarshal(msg, &v.m)
+		case "L":
+			err = json.Unmarshal(msg, &v.l)
+		case "BOOL", "NULL":
+			err = json.Unmarshal(msg, &v.bool)
+		default:
+			return fmt.Errorf("unknown attribute value type %q", typ)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if found != 1 {
+		return fmt.Errorf("attribute value must have exactly one member, got %d", found)
+	}
+	return nil
+}
+
+// validate reports the first problem that DynamoDB would reject the value for.
+func (v *value) validate() error {
+	if v == nil {
+		return fmt.Errorf("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+	}
+
+	switch v.typ {
+	case "N":
+		if _, ok := parseNumber(v.s); !ok {
+			return fmt.Errorf("A value provided cannot be converted into a number")
+		}
+	case "SS", "NS", "BS":
+		n := len(v.set)
+		if v.typ == "BS" {
+			n = len(v.bs)
+		}
+		if n == 0 {
+			return fmt.Errorf("One or more parameter values were invalid: An string set  may not be empty")
+		}
+		seen := make(map[string]bool, n)
+		for _, e := range v.elements() {
+			k := e.keyString()
+			if e.typ == "N" {
+				if _, ok := parseNumber(e.s); !ok {
+					return fmt.Errorf("A value provided cannot be converted into a number")
+				}
+			}
+			if seen[k] {
+				return fmt.Errorf("One or more parameter values were invalid: Input collection %s contains duplicates.", v.typ)
+			}
+			seen[k] = true
+		}
+	case "M":
+		for _, e := range v.m {
+			if err := e.validate(); err != nil {
+				return err
+			}
+		}
+	case "L":
+		for _, e := range v.l {
+			if err := e.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *value) clone() *value {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	if v.b != nil {
+		c.b = append([]byte(nil), v.b...)
+	}
+	if v.set != nil {
+		c.set = append([]string(nil), v.set...)
+	}
+	if v.bs != nil {
+		c.bs = make([][]byte, len(v.bs))
+		for i, b := range v.bs {
+			c.bs[i] = append([]byte(nil), b...)
+		}
+	}
+	if v.m != nil {
+		c.m = make(map[string]*value, len(v.m))
+		for k, e := range v.m {
+			c.m[k] = e.clone()
+		}
+	}
+	if v.l != nil {
+		c.l = make([]*value, len(v.l))
+		for i, e := range v.l {
+			c.l[i] = e.clone()
+		}
+	}
+	return &c
+}
+
+func (it item) clone() item {
+	if it == nil {
+		return nil
+	}
+	c := make(item, len(it))
+	for k, v := range it {
+		c[k] = v.clone()
+	}
+	return c
+}
+
+// elements returns the members of a set as scalar values.
+func (v *value) elements() []*value {
+	switch v.typ {
+	case "SS":
+		out := make([]*value, len(v.set))
+		for i, s := range v.set {
+			out[i] = &value{typ: "S", s: s}
+		}
+		return out
+	case "NS":
+		out := make([]*value, len(v.set))
+		for i, s := range v.set {
+			out[i] = &value{typ: "N", s: s}
+		}
+		return out
+	case "BS":
+		out := make([]*value, len(v.bs))
+		for i, b := range v.bs {
+			out[i] = &value{typ: "B", b: b}
+		}
+		return out
+	}
+	return nil
+}
+
+func setFromElements(typ string, elems []*value) *value {
+	v := &value{typ: typ}
+	for _, e := range elems {
+		if typ == "BS" {
+			v.bs = append(v.bs, e.b)
+		} else {
+			v.set = append(v.set, e.s)
+		}
+	}
+	return v
+}
+
+// keyString is a canonical encoding of a scalar value, usable as a map key.
+func (v *value) keyString() string {
+	switch v.typ {
+	case "S":
+		return "S:" + v.s
+	case "N":
+		if r, ok := parseNumber(v.s); ok {
+			return "N:" + formatNumber(r)
+		}
+		return "N:" + v.s
+	case "B":
+		return "B:" + base64.StdEncoding.EncodeToString(v.b)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func parseNumber(s string) (*big.Rat, bool) {
+	if s == "" || strings.ContainsAny(s, "/xXpP") {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(38)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func equal(a, b *value) bool {
+	if a == nil || b == nil || a.typ != b.typ {
+		return false
+	}
+
+	switch a.typ {
+	case "S", "N", "B":
+		return a.keyString() == b.keyString()
+	case "BOOL", "NULL":
+		return a.bool == b.bool
+	case "SS", "NS", "BS":
+		ae, be := a.elements(), b.elements()
+		if len(ae) != len(be) {
+			return false
+		}
+		seen := make(map[string]bool, len(ae))
+		for _, e := range ae {
+			seen[e.keyString()] = true
+		}
+		for _, e := range be {
+			if !seen[e.keyString()] {
+				return false
+			}
+		}
+		return true
+	case "M":
+		if len(a.m) != len(b.m) {
+			return false
+		}
+		for k, e := range a.m {
+			if !equal(e, b.m[k]) {
+				return false
+			}
+		}
+		return true
+	case "L":
+		if len(a.l) != len(b.l) {
+			return false
+		}
+		for i := range a.l {
+			if !equal(a.l[i], b.l[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compare orders two scalar values of the same type. ok is false when the
+// values are not comparable.
+func compare(a, b *value) (int, bool) {
+	if a == nil || b == nil || a.typ != b.typ {
+		return 0, false
+	}
+
+	switch a.typ {
+	case "S":
+		return strings.Compare(a.s, b.s), true
+	case "N":
+		ra, ok1 := parseNumber(a.s)
+		rb, ok2 := parseNumber(b.s)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return ra.Cmp(rb), true
+	case "B":
+		return bytes.Compare(a.b, b.b), true
+	}
+	return 0, false
+}
+
+func (v *value) size() int {
+	switch v.typ {
+	case "S":
+		return len(v.s)
+	case "N":
+		return len(strings.TrimLeft(strings.Replace(v.s, ".", "", 1), "-0"))/2 + 1
+	case "B":
+		return len(v.b)
+	case "SS", "NS", "BS":
+		n := 0
+		for _, e := range v.elements() {
+			n += e.size()
+		}
+		return n
+	case "M":
+		n := 3
+		for k, e := range v.m {
+			n += len(k) + e.size() + 1
+		}
+		return n
+	case "L":
+		n := 3
+		for _, e := range v.l {
+			n += e.size() + 1
+		}
+		return n
+	}
+	return 1
+}
+
+func (it item) size() int {
+	n := 0
+	for k, v := range it {
+		n += len(k) + v.size()
+	}
+	return n
+}
+
+// length implements the size() function of condition expressions.
+func (v *value) length() (int, bool) {
+	switch v.typ {
+	case "S":
+		return utf8.RuneCountInString(v.s), true
+	case "B":
+		return len(v.b), true
+	case "SS", "NS":
+		return len(v.set), true
+	case "BS":
+		return len(v.bs), true
+	case "M":
+		return len(v.m), true
+	case "L":
+		return len(v.l), true
+	}
+	return 0, false
+}
+
+func sortedNames(it map[string]*value) []string {
+	names := make([]string, 0, len(it))
+	for k := range it {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
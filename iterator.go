@@ -0,0 +1,171 @@
+package ddbmodel
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+)
+
+// Iterator walks the results of a Query or Scan one item at a time, reading
+// a page only once the items before it have been consumed:
+//
+//	it := w.QueryIterator()
+//	var task Task
+//	for it.Next(&task) {
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	ctx   context.Context
+	page  pageFunc
+	limit int64
+
+	// esKey started the current page, which ends at lastKey.
+	esKey   map[string]*dynamodb.AttributeValue
+	lastKey map[string]*dynamodb.AttributeValue
+	items   []map[string]*dynamodb.AttributeValue
+	next    int
+	fetched bool
+
+	// keyNames are the attributes of a key that starts a page, and index
+	// the index the pages are read from.
+	keyNames []string
+	index    string
+	err      error
+}
+
+// QueryIterator runs Query lazily, starting at the offset of w and reading
+// pages of QueryLimit items.
+func (w *Worker) QueryIterator() *Iterator {
+	page, err := w.queryPages(w.IndexName)
+	it := w.newIterator(page)
+	it.err = err
+	return it
+}
+
+// ScanIterator is QueryIterator for Scan.
+func (w *Worker) ScanIterator() *Iterator {
+	return w.newIterator(w.scanPages())
+}
+
+func (w *Worker) newIterator(page pageFunc) *Iterator {
+	it := &Iterator{
+		ctx:   w.requestContext(),
+		page:  page,
+		limit: w.QueryLimit,
+		index: w.IndexName,
+	}
+	if len(w.QueryOffset) > 0 {
+		it.esKey = DecodeLastEvaluatedKey(w.QueryOffset)
+	}
+	if len(it.esKey) > 0 {
+		it.keyNames = attributeNames(it.esKey)
+	} else if s := registeredTable(w.TableName); s != nil && s.Model != nil {
+		it.keyNames = s.Model.pageKeyNames(it.index)
+	}
+	return it
+}
+
+// Next decodes the next item into dst. It returns false when the results
+// are exhausted or an error occurred, which Err then reports.
+func (it *Iterator) Next(dst interface{}) bool {
+	if it.keyNames == nil {
+		if m, _ := modelOf(dst); m != nil {
+			it.keyNames = m.pageKeyNames(it.index)
+		}
+	}
+	for it.err == nil && it.next >= len(it.items) {
+		if it.fetched && len(it.lastKey) == 0 {
+			return false
+		}
+		it.fetch()
+	}
+	if it.err != nil {
+		return false
+	}
+
+	item := it.items[it.next]
+	it.next++
+	// dst is reset so that attributes missing from this item do not keep
+	// the values of the previous one.
+	if v := reflect.ValueOf(dst); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	if err := dynamodbattribute.UnmarshalMap(item, dst); err != nil {
+		it.err = errors.Wrap(err, "UnmarshalMap failed")
+		return false
+	}
+	return true
+}
+
+func (it *Iterator) fetch() {
+	if it.fetched {
+		if err := it.ctx.Err(); err != nil {
+			it.err = errors.Wrap(err, "Read next page failed")
+			return
+		}
+		it.esKey = it.lastKey
+	}
+
+	items, lastKey, err := it.page(it.ctx, it.esKey, it.limit)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.items, it.lastKey, it.next, it.fetched = items, lastKey, 0, true
+	if it.keyNames == nil && len(lastKey) > 0 {
+		it.keyNames = attributeNames(lastKey)
+	}
+}
+
+// done reports whether Next has returned every item.
+func (it *Iterator) done() bool {
+	return it.err == nil && it.fetched && it.next >= len(it.items) && len(it.lastKey) == 0
+}
+
+// Err returns the error that stopped Next, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Offset returns the offset that resumes after the last item Next returned,
+// or "" once every item has been returned.
+func (it *Iterator) Offset() string {
+	switch {
+	case !it.fetched:
+		return EncodeLastEvaluatedKey(it.esKey)
+	case it.next >= len(it.items):
+		return EncodeLastEvaluatedKey(it.lastKey)
+	}
+
+	// Within a page the offset is the key of the last item returned, whose
+	// attributes are those of the offset the iterator started at, of a
+	// LastEvaluatedKey or of the model of the table or the items. Without
+	// any, the offset falls back to the start of the page, which reads some
+	// items again.
+	if it.keyNames == nil {
+		return EncodeLastEvaluatedKey(it.esKey)
+	}
+
+	item := it.items[it.next-1]
+	key := make(map[string]*dynamodb.AttributeValue, len(it.keyNames))
+	for _, name := range it.keyNames {
+		key[name] = item[name]
+	}
+	return EncodeLastEvaluatedKey(key)
+}
+
+func attributeNames(item map[string]*dynamodb.AttributeValue) []string {
+	names := make([]string, 0, len(item))
+	for name := range item {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
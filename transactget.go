@@ -0,0 +1,103 @@
+package ddbmodel
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/pkg/errors"
+)
+
+// TransactGet is an item for TransactGet to read.
+type TransactGet struct {
+	Table string
+	Key   map[string]interface{}
+	// Projection names the attributes to read; all of them when empty.
+	Projection []string
+	// Dst receives the item, as it does with Get.
+	Dst interface{}
+	// NotFound is set by TransactGet when there is no item with Key, in
+	// which case Dst is left alone.
+	NotFound bool
+}
+
+// TransactGet reads the items of gets, at most 100 from any tables, with
+// one TransactGetItems call, so that they are all read as of the same
+// moment. Each item is decoded into the Dst of its entry, and the entries
+// whose item does not exist are marked NotFound. When DynamoDB cancels the
+// read, the error is a *TransactionError.
+func (w *Worker) TransactGet(gets []TransactGet) error {
+	if len(gets) == 0 {
+		return nil
+	}
+	if len(gets) > maxTransactActions {
+		return &RequestError{Kind: ErrValidation, Cause: fmt.Errorf("transaction has %d gets, more than the limit of %d", len(gets), maxTransactActions)}
+	}
+
+	input := &dynamodb.TransactGetItemsInput{
+		TransactItems: make([]*dynamodb.TransactGetItem, len(gets)),
+	}
+	targets := make([]transactTarget, len(gets))
+	for i, g := range gets {
+		get, err := transactGetItem(g)
+		if err != nil {
+			return errors.Wrapf(err, "transaction get %d", i)
+		}
+		input.TransactItems[i] = &dynamodb.TransactGetItem{Get: get}
+		targets[i] = transactTarget{g.Table, get.Key}
+	}
+
+	ctx := w.requestContext()
+	output, err := newDynamoDB(w.AwsSession).TransactGetItemsWithContext(ctx, input)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return errors.Wrap(transactionError(classifyError(err), targets), "dynamodb TransactGetItems failed")
+	}
+
+	for i := range gets {
+		var item map[string]*dynamodb.AttributeValue
+		if i < len(output.Responses) && output.Responses[i] != nil {
+			item = output.Responses[i].Item
+		}
+		gets[i].NotFound = len(item) == 0
+		if gets[i].NotFound {
+			continue
+		}
+		if err := dynamodbattribute.UnmarshalMap(item, gets[i].Dst); err != nil {
+			return errors.Wrapf(err, "Unmarshal item %d error", i)
+		}
+	}
+	return nil
+}
+
+func transactGetItem(g TransactGet) (*dynamodb.Get, error) {
+	key, err := dynamodbattribute.MarshalMap(g.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "MarshalMap error")
+	}
+	get := &dynamodb.Get{
+		TableName: aws.String(g.Table),
+		Key:       key,
+	}
+	if len(g.Projection) == 0 {
+		return get, nil
+	}
+
+	names := make([]expression.NameBuilder, len(g.Projection))
+	for i, n := range g.Projection {
+		names[i] = expression.Name(n)
+	}
+	expr, err := expression.NewBuilder().
+		WithProjection(expression.ProjectionBuilder{}.AddNames(names...)).
+		Build()
+	if err != nil {
+		return nil, errors.Wrap(err, "Build expression error")
+	}
+	get.ProjectionExpression = expr.Projection()
+	get.ExpressionAttributeNames = expr.Names()
+	return get, nil
+}
@@ -1,14 +1,29 @@
 package ddbmodel
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/pkg/errors"
 )
 
+const (
+	maxTransactActions = 100
+	maxTransactBytes   = 4 << 20
+)
+
 type Transaction struct {
 	AwsSession  *session.Session
 	UpdateItems []*dynamodb.Update
+	RetryPolicy TransactRetry
 }
 
 func NewTransaction(sess *session.Session, items []*dynamodb.Update) Transaction {
@@ -18,6 +33,12 @@ func NewTransaction(sess *session.Session, items []*dynamodb.Update) Transaction
 	}
 }
 
+// Retry makes Transacte retry as r tells it to.
+func (t Transaction) Retry(r TransactRetry) Transaction {
+	t.RetryPolicy = r
+	return t
+}
+
 func (t Transaction) Transacte() error {
 	items := make([]*dynamodb.TransactWriteItem, 0)
 	for i := range t.UpdateItems {
@@ -25,12 +46,430 @@ func (t Transaction) Transacte() error {
 			Update: t.UpdateItems[i],
 		})
 	}
-	_, err := dynamodb.New(t.AwsSession).TransactWriteItems(
-		&dynamodb.TransactWriteItemsInput{
-			TransactItems: items,
-		})
+	err := transactWriteItems(aws.BackgroundContext(), newDynamoDB(t.AwsSession), &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: aws.String(newRequestToken()),
+		TransactItems:      items,
+	}, t.RetryPolicy)
 	if err != nil {
 		return errors.Wrap(err, "transaction failed")
 	}
 	return nil
 }
+
+// TransactRetry tells how to retry a transaction that DynamoDB canceled
+// for reasons that may pass, such as a conflict with another transaction.
+// Every attempt sends the same client request token, so that a transaction
+// that was committed after all is not applied twice.
+type TransactRetry struct {
+	// MaxAttempts is how many times the transaction is sent at most; the
+	// zero value sends it once.
+	MaxAttempts int
+	Backoff     Backoff
+	// Reasons are the cancellation reason codes worth a retry. The
+	// transaction is retried only when every action that failed did so for
+	// one of them.
+	Reasons []string
+}
+
+var DefaultTransactRetry = TransactRetry{
+	MaxAttempts: 5,
+	Backoff:     DefaultBackoff,
+	Reasons:     []string{"TransactionConflict", "ProvisionedThroughputExceeded", "ThrottlingError"},
+}
+
+// retryable reports whether err, from sending a transaction, is worth
+// sending it again for.
+func (r TransactRetry) retryable(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeTransactionInProgressException {
+		return true
+	}
+
+	var canceled *TransactionCanceledError
+	if !errors.As(err, &canceled) {
+		return false
+	}
+	retry := false
+	for _, reason := range canceled.Reasons {
+		if reason.Code == "None" {
+			continue
+		}
+		if !containsString(r.Reasons, reason.Code) {
+			return false
+		}
+		retry = true
+	}
+	return retry
+}
+
+func (r TransactRetry) backoff() Backoff {
+	if r.Backoff == (Backoff{}) {
+		return DefaultBackoff
+	}
+	return r.Backoff
+}
+
+// transactWriteItems sends input, again as long as retry allows it, and
+// returns the error of the last attempt.
+func transactWriteItems(ctx context.Context, client *dynamodb.DynamoDB, input *dynamodb.TransactWriteItemsInput, retry TransactRetry) error {
+	for attempt := 1; ; attempt++ {
+		_, err := client.TransactWriteItemsWithContext(ctx, input)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		err = transactionError(classifyError(err), writeTargets(input.TransactItems))
+		if attempt >= retry.MaxAttempts || !retry.retryable(err) {
+			return err
+		}
+		if werr := retry.backoff().Wait(ctx, attempt-1); werr != nil {
+			return errors.Wrap(werr, "retry transaction failed")
+		}
+	}
+}
+
+// TransactWriter collects puts, deletes, updates and condition checks
+// against any tables, each with its own conditions, and writes them with
+// TransactWriteItems: either every action succeeds or none does.
+type TransactWriter struct {
+	worker    *Worker
+	actions   []transactAction
+	token     string
+	returnOld bool
+	retry     TransactRetry
+	err       error
+}
+
+// TransactWriter starts a transaction that uses the session and context
+// of w.
+func (w *Worker) TransactWriter() *TransactWriter {
+	return &TransactWriter{worker: w}
+}
+
+// Token sets the client request token that makes the transaction
+// idempotent: DynamoDB applies a transaction once however many times it is
+// sent with the same token within ten minutes. Write generates a token when
+// none is set.
+func (t *TransactWriter) Token(token string) *TransactWriter {
+	t.token = token
+	return t
+}
+
+// Retry makes every Write of t retry as r tells it to.
+func (t *TransactWriter) Retry(r TransactRetry) *TransactWriter {
+	t.retry = r
+	return t
+}
+
+// ReturnOldItems makes the actions whose condition fails report the item
+// as it was in the TransactionError of Write.
+func (t *TransactWriter) ReturnOldItems() *TransactWriter {
+	t.returnOld = true
+	return t
+}
+
+// Put stores obj in tableName if all of conds hold.
+func (t *TransactWriter) Put(tableName string, obj interface{}, conds ...expression.ConditionBuilder) *TransactWriter {
+	av, err := dynamodbattribute.MarshalMap(obj)
+	if err != nil {
+		t.fail(errors.Wrap(err, "dynamodbattribute marshal failed"))
+		return t
+	}
+	expr, ok, err := transactExpression(nil, conds)
+	if err != nil {
+		t.fail(err)
+		return t
+	}
+
+	put := &dynamodb.Put{TableName: aws.String(tableName), Item: av}
+	if ok {
+		put.ConditionExpression = expr.Condition()
+		put.ExpressionAttributeNames = expr.Names()
+		put.ExpressionAttributeValues = expr.Values()
+	}
+	t.add(&dynamodb.TransactWriteItem{Put: put}, itemSize(av)+itemSize(put.ExpressionAttributeValues))
+	return t
+}
+
+// Delete deletes the item with key from tableName if all of conds hold.
+func (t *TransactWriter) Delete(tableName string, key map[string]interface{}, conds ...expression.ConditionBuilder) *TransactWriter {
+	av, expr, ok, err := transactKeyExpression(key, nil, conds)
+	if err != nil {
+		t.fail(err)
+		return t
+	}
+
+	del := &dynamodb.Delete{TableName: aws.String(tableName), Key: av}
+	if ok {
+		del.ConditionExpression = expr.Condition()
+		del.ExpressionAttributeNames = expr.Names()
+		del.ExpressionAttributeValues = expr.Values()
+	}
+	t.add(&dynamodb.TransactWriteItem{Delete: del}, itemSize(av)+itemSize(del.ExpressionAttributeValues))
+	return t
+}
+
+// ConditionCheck makes the transaction fail unless cond holds for the item
+// with key in tableName, without writing the item.
+func (t *TransactWriter) ConditionCheck(tableName string, key map[string]interface{}, cond expression.ConditionBuilder) *TransactWriter {
+	av, expr, _, err := transactKeyExpression(key, nil, []expression.ConditionBuilder{cond})
+	if err != nil {
+		t.fail(err)
+		return t
+	}
+
+	check := &dynamodb.ConditionCheck{
+		TableName:                 aws.String(tableName),
+		Key:                       av,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+	t.add(&dynamodb.TransactWriteItem{ConditionCheck: check}, itemSize(av)+itemSize(check.ExpressionAttributeValues))
+	return t
+}
+
+// Update applies update, built with its Set, Add, Remove and Delete, to the
+// item with key in tableName if all of conds hold.
+func (t *TransactWriter) Update(tableName string, key map[string]interface{}, update expression.UpdateBuilder, conds ...expression.ConditionBuilder) *TransactWriter {
+	av, expr, _, err := transactKeyExpression(key, &update, conds)
+	if err != nil {
+		t.fail(err)
+		return t
+	}
+
+	upd := &dynamodb.Update{
+		TableName:                 aws.String(tableName),
+		Key:                       av,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+	t.add(&dynamodb.TransactWriteItem{Update: upd}, itemSize(av)+itemSize(upd.ExpressionAttributeValues))
+	return t
+}
+
+func (t *TransactWriter) add(item *dynamodb.TransactWriteItem, size int) {
+	t.actions = append(t.actions, transactAction{item: item, size: size})
+}
+
+// fail keeps the first error of the actions added, which Write returns.
+func (t *TransactWriter) fail(err error) {
+	if t.err == nil {
+		t.err = errors.Wrapf(err, "transaction action %d", len(t.actions))
+	}
+	t.actions = append(t.actions, transactAction{})
+}
+
+// Write sends the collected actions in one transaction and resets t. It
+// refuses transactions over the limits of DynamoDB without sending them.
+// When DynamoDB cancels the transaction, the error is a *TransactionError.
+func (t *TransactWriter) Write() error {
+	actions, token, returnOld, err := t.actions, t.token, t.returnOld, t.err
+	t.actions, t.token, t.returnOld, t.err = nil, "", false, nil
+	if err != nil {
+		return err
+	}
+	if err := checkTransactLimits(actions); err != nil {
+		return err
+	}
+	if token == "" {
+		token = newRequestToken()
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: aws.String(token),
+		TransactItems:      make([]*dynamodb.TransactWriteItem, len(actions)),
+	}
+	for i, a := range actions {
+		input.TransactItems[i] = a.item
+		if returnOld {
+			returnOldOnFailure(a.item)
+		}
+	}
+
+	err = transactWriteItems(t.worker.requestContext(), newDynamoDB(t.worker.AwsSession), input, t.retry)
+	if err != nil {
+		return errors.Wrap(err, "dynamodb TransactWriteItems failed")
+	}
+	return nil
+}
+
+// TransactionFailure is an action that made DynamoDB cancel a transaction.
+type TransactionFailure struct {
+	// Index is the position of the action in the transaction.
+	Index int
+	Table string
+	// Key is the key of the item of the action, or the whole item for a Put.
+	Key map[string]*dynamodb.AttributeValue
+	// Code tells why the action failed: ConditionalCheckFailed,
+	// TransactionConflict, ItemCollectionSizeLimitExceeded,
+	// ProvisionedThroughputExceeded, ThrottlingError or ValidationError.
+	Code    string
+	Message string
+	// OldItem is the item as it was when the condition of the action
+	// failed, if the transaction asked for it.
+	OldItem map[string]*dynamodb.AttributeValue
+}
+
+// TransactionError lists the actions that made DynamoDB cancel a
+// transaction; none of its actions were written. It wraps the
+// *TransactionCanceledError it was made from. Failures is empty when the
+// reasons of that error do not map to the actions.
+type TransactionError struct {
+	Failures []TransactionFailure
+	Cause    error
+}
+
+func (e *TransactionError) Error() string {
+	if len(e.Failures) == 0 {
+		return e.Cause.Error()
+	}
+	f := e.Failures[0]
+	return fmt.Sprintf("transaction canceled by %d actions, first at %d on %s: %s", len(e.Failures), f.Index, f.Table, f.Code)
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Cause
+}
+
+// transactionError maps the cancellation reasons of err back to targets,
+// the items of the transaction, and returns other errors as they are.
+func transactionError(err error, targets []transactTarget) error {
+	var canceled *TransactionCanceledError
+	if !errors.As(err, &canceled) {
+		return err
+	}
+	if len(canceled.Reasons) != len(targets) {
+		return &TransactionError{Cause: err}
+	}
+
+	var failures []TransactionFailure
+	for i, r := range canceled.Reasons {
+		if r.Code == "None" {
+			continue
+		}
+		failures = append(failures, TransactionFailure{
+			Index:   i,
+			Table:   targets[i].table,
+			Key:     targets[i].key,
+			Code:    r.Code,
+			Message: r.Message,
+			OldItem: r.Item,
+		})
+	}
+	return &TransactionError{Failures: failures, Cause: err}
+}
+
+// transactTarget is the item an action of a transaction is on.
+type transactTarget struct {
+	table string
+	key   map[string]*dynamodb.AttributeValue
+}
+
+func writeTargets(items []*dynamodb.TransactWriteItem) []transactTarget {
+	targets := make([]transactTarget, len(items))
+	for i, item := range items {
+		switch {
+		case item.ConditionCheck != nil:
+			targets[i] = transactTarget{aws.StringValue(item.ConditionCheck.TableName), item.ConditionCheck.Key}
+		case item.Put != nil:
+			targets[i] = transactTarget{aws.StringValue(item.Put.TableName), item.Put.Item}
+		case item.Delete != nil:
+			targets[i] = transactTarget{aws.StringValue(item.Delete.TableName), item.Delete.Key}
+		case item.Update != nil:
+			targets[i] = transactTarget{aws.StringValue(item.Update.TableName), item.Update.Key}
+		}
+	}
+	return targets
+}
+
+// returnOldOnFailure asks for the item as it was should the condition of
+// item fail.
+func returnOldOnFailure(item *dynamodb.TransactWriteItem) {
+	allOld := aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld)
+	switch {
+	case item.ConditionCheck != nil:
+		item.ConditionCheck.ReturnValuesOnConditionCheckFailure = allOld
+	case item.Put != nil && item.Put.ConditionExpression != nil:
+		item.Put.ReturnValuesOnConditionCheckFailure = allOld
+	case item.Delete != nil && item.Delete.ConditionExpression != nil:
+		item.Delete.ReturnValuesOnConditionCheckFailure = allOld
+	case item.Update != nil && item.Update.ConditionExpression != nil:
+		item.Update.ReturnValuesOnConditionCheckFailure = allOld
+	}
+}
+
+// transactAction is an action of a transaction along with its size.
+type transactAction struct {
+	item *dynamodb.TransactWriteItem
+	size int
+}
+
+func checkTransactLimits(actions []transactAction) error {
+	switch {
+	case len(actions) == 0:
+		return &RequestError{Kind: ErrValidation, Cause: errors.New("transaction has no actions")}
+	case len(actions) > maxTransactActions:
+		return &RequestError{Kind: ErrValidation, Cause: fmt.Errorf("transaction has %d actions, more than the limit of %d", len(actions), maxTransactActions)}
+	}
+
+	size := 0
+	for i, a := range actions {
+		if a.size > maxItemBytes {
+			return &RequestError{Kind: ErrItemTooLarge, Cause: fmt.Errorf("action %d has size %d, more than the limit of %d bytes", i, a.size, maxItemBytes)}
+		}
+		size += a.size
+	}
+	if size > maxTransactBytes {
+		return &RequestError{Kind: ErrValidation, Cause: fmt.Errorf("transaction has size %d, more than the limit of %d bytes", size, maxTransactBytes)}
+	}
+	return nil
+}
+
+// transactExpression builds the expression of an action from update, if
+// not nil, and the conjunction of conds. It reports false when there is
+// neither.
+func transactExpression(update *expression.UpdateBuilder, conds []expression.ConditionBuilder) (expression.Expression, bool, error) {
+	if update == nil && len(conds) == 0 {
+		return expression.Expression{}, false, nil
+	}
+	builder := expression.NewBuilder()
+	if update != nil {
+		builder = builder.WithUpdate(*update)
+	}
+	switch len(conds) {
+	case 0:
+	case 1:
+		builder = builder.WithCondition(conds[0])
+	default:
+		builder = builder.WithCondition(expression.And(conds[0], conds[1], conds[2:]...))
+	}
+
+	expr, err := builder.Build()
+	if err != nil {
+		return expr, false, errors.Wrap(err, "Build expression error")
+	}
+	return expr, true, nil
+}
+
+func transactKeyExpression(key map[string]interface{}, update *expression.UpdateBuilder, conds []expression.ConditionBuilder) (map[string]*dynamodb.AttributeValue, expression.Expression, bool, error) {
+	av, err := dynamodbattribute.MarshalMap(key)
+	if err != nil {
+		return nil, expression.Expression{}, false, errors.Wrap(err, "MarshalMap error")
+	}
+	expr, ok, err := transactExpression(update, conds)
+	return av, expr, ok, err
+}
+
+// newRequestToken returns a random client request token.
+func newRequestToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -4,16 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/thisissc/awsclient"
 	"github.com/thisissc/config"
+	"github.com/thisissc/ddbmodel/ddbmodeltest"
 )
 
-//RUN the test need config.toml and dynamedb_table
+//RUN the test against dynamedb_table with config.toml, or against ddbmodeltest without it
 const (
 	TestDynamodbTableName = "Task"
 )
@@ -23,8 +27,14 @@ type TestDate struct {
 	Count int    `dynamodbav:",omitempty"`
 }
 
+var setupLocalOnce sync.Once
+
 func SetupTest() {
 	configFile := "config.toml"
+	if _, err := os.Stat(configFile); os.IsNotExist(err) {
+		setupLocalOnce.Do(setupLocalTest)
+		return
+	}
 	config.SetConfigFile(configFile)
 	err := config.LoadConfig("AWS", &awsclient.Config{})
 	if err != nil {
@@ -33,6 +43,31 @@ func SetupTest() {
 	}
 }
 
+// setupLocalTest serves the test table from a local ddbmodeltest server and
+// points the default awsclient session at it.
+func setupLocalTest() {
+	db := ddbmodeltest.New()
+	db.TransactionDelay = 100 * time.Millisecond
+	err := db.CreateTable(ddbmodeltest.TableDef{
+		Name:    TestDynamodbTableName,
+		HashKey: ddbmodeltest.KeyDef{Name: "ID", Type: "S"},
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	srv, err := ddbmodeltest.NewServer(db, "")
+	if err != nil {
+		log.Panic(err)
+	}
+	os.Setenv("AWS_ENDPOINT_URL_DYNAMODB", srv.URL)
+	awsclient.SetSession(awsclient.AWSProfileDefault, awsclient.AwsConfig{
+		Region:          "local",
+		AccessKeyId:     "local",
+		AccessKeySecret: "local",
+	})
+}
+
 func generateWorkers(session *session.Session, count int) (workers []Worker) {
 	if session == nil {
 		err := errors.New("session is null")
@@ -141,18 +176,35 @@ func TestTransaction_TransacteWithConcurrency(t *testing.T) {
 				UpdateItems: generateSuccessCase(tt.fields.Workers),
 			}
 			var wg sync.WaitGroup
+			// A transaction that loses the race must name the items it
+			// conflicted on.
+			checkConflict := func(err error) {
+				var txErr *TransactionError
+				if !errors.As(err, &txErr) || len(txErr.Failures) == 0 {
+					t.Errorf("Transaction.Transacte() error = %v, want *TransactionError", err)
+					return
+				}
+				for _, f := range txErr.Failures {
+					if id := f.Key["ID"]; f.Code != "TransactionConflict" || id == nil || aws.StringValue(id.S) != fmt.Sprint(f.Index) {
+						t.Errorf("Transaction.Transacte() failure = %+v, want a TransactionConflict on item %d", f, f.Index)
+					}
+				}
+			}
+			tr.AwsSession = awsclient.GetSession()
 			wg.Add(2)
 			go func() {
-				tr.AwsSession = awsclient.GetSession()
 				if err := tr.Transacte(); (err != nil) != tt.wantErr {
 					t.Logf("Transaction.Transacte() error = %v, wantErr %v", err, tt.wantErr)
+				} else if err != nil {
+					checkConflict(err)
 				}
 				wg.Done()
 			}()
 			go func() {
-				tr.AwsSession = awsclient.GetSession()
 				if err := tr.Transacte(); (err != nil) != tt.wantErr {
 					t.Logf("Transaction.Transacte() error = %v, wantErr %v", err, tt.wantErr)
+				} else if err != nil {
+					checkConflict(err)
 				}
 				wg.Done()
 			}()
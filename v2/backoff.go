@@ -0,0 +1,55 @@
+package ddbmodel
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Backoff spaces out retries exponentially from Base up to Max, waiting a
+// random ("full jitter") part of each step so that clients spread out. A
+// zero Max caps the steps at the Max of DefaultBackoff, or at Base if that
+// is longer.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+var DefaultBackoff = Backoff{
+	Base: 25 * time.Millisecond,
+	Max:  2 * time.Second,
+}
+
+// Delay returns how long to wait before retry number attempt, from 0.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Max
+	if d <= 0 {
+		d = DefaultBackoff.Max
+		if b.Base > d {
+			d = b.Base
+		}
+	}
+	if attempt < 32 {
+		if step := b.Base << uint(attempt); step > 0 && step < d {
+			d = step
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Wait sleeps for Delay(attempt), returning early with the context's error
+// if ctx is done first.
+func (b Backoff) Wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(b.Delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,356 @@
+package ddbmodel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxBatchWriteRequests = 25
+	maxBatchWriteBytes    = 16 << 20
+	maxItemBytes          = 400 << 10
+)
+
+// BatchFailure is an input item that a batch operation gave up on.
+type BatchFailure struct {
+	// Index is the position of Item in the input.
+	Index int
+	Table string
+	Item  interface{}
+	Err   error
+}
+
+// BatchWriteError lists the items a batch write could not store; all the
+// other items were stored.
+type BatchWriteError struct {
+	Failed []BatchFailure
+}
+
+func newBatchWriteError(failed []BatchFailure) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+	return &BatchWriteError{Failed: failed}
+}
+
+func (e *BatchWriteError) Error() string {
+	return fmt.Sprintf("batch write failed for %d items, first at %d: %v", len(e.Failed), e.Failed[0].Index, e.Failed[0].Err)
+}
+
+func (e *BatchWriteError) Unwrap() error {
+	return e.Failed[0].Err
+}
+
+// BatchWriter collects puts and deletes against any tables and writes them
+// with BatchWriteItem, in chunks within its limits, re-submitting the
+// requests DynamoDB leaves unprocessed.
+type BatchWriter struct {
+	worker   *Worker
+	requests []batchRequest
+	failed   []BatchFailure
+	count    int
+}
+
+// BatchWriter starts a batch write that uses the session, context and
+// backoff of w.
+func (w *Worker) BatchWriter() *BatchWriter {
+	return &BatchWriter{worker: w}
+}
+
+func (b *BatchWriter) Put(tableName string, obj interface{}) *BatchWriter {
+	b.add(tableName, obj, func(av map[string]types.AttributeValue) types.WriteRequest {
+		return types.WriteRequest{PutRequest: &types.PutRequest{Item: av}}
+	})
+	return b
+}
+
+func (b *BatchWriter) Delete(tableName string, key map[string]interface{}) *BatchWriter {
+	b.add(tableName, key, func(av map[string]types.AttributeValue) types.WriteRequest {
+		return types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: av}}
+	})
+	return b
+}
+
+func (b *BatchWriter) add(tableName string, source interface{}, request func(map[string]types.AttributeValue) types.WriteRequest) {
+	index := b.count
+	b.count++
+
+	av, err := attributevalue.MarshalMap(source)
+	if err != nil {
+		b.failed = append(b.failed, BatchFailure{Index: index, Table: tableName, Item: source, Err: errors.Wrap(err, "attributevalue marshal failed")})
+		return
+	}
+	b.requests = append(b.requests, batchRequest{
+		index:   index,
+		source:  source,
+		table:   tableName,
+		request: request(av),
+		size:    itemSize(av),
+	})
+}
+
+// Write sends the collected requests and resets b. Items that could not be
+// written are reported in a *BatchWriteError, indexed in the order they
+// were added; every other item was written.
+func (b *BatchWriter) Write() error {
+	failed := append(b.failed, b.worker.batchWrite(b.requests)...)
+	b.requests, b.failed, b.count = nil, nil, 0
+	return newBatchWriteError(failed)
+}
+
+// batchRequest is a write request on its way through BatchWriteItem, along
+// with the input it came from.
+type batchRequest struct {
+	index   int
+	source  interface{}
+	table   string
+	request types.WriteRequest
+	size    int
+	// key identifies the item written, as itemKey makes it.
+	key string
+}
+
+func (r batchRequest) fail(err error) BatchFailure {
+	return BatchFailure{Index: r.index, Table: r.table, Item: r.source, Err: err}
+}
+
+// writeItem is the item wr puts or the key it deletes.
+func writeItem(wr types.WriteRequest) map[string]types.AttributeValue {
+	if wr.PutRequest != nil {
+		return wr.PutRequest.Item
+	}
+	return wr.DeleteRequest.Key
+}
+
+// itemKey identifies item of table by its values of the key attributes
+// names.
+func itemKey(table string, item map[string]types.AttributeValue, names []string) string {
+	var b strings.Builder
+	b.WriteString(table)
+	for _, name := range names {
+		var value string
+		switch av := item[name].(type) {
+		case *types.AttributeValueMemberS:
+			value = "S" + av.Value
+		case *types.AttributeValueMemberN:
+			value = "N" + av.Value
+		case *types.AttributeValueMemberB:
+			value = "B" + string(av.Value)
+		}
+		fmt.Fprintf(&b, "\x00%s\x00%s", name, value)
+	}
+	return b.String()
+}
+
+// batchWrite sends reqs in as few BatchWriteItem calls as the request
+// limits allow and returns the requests that could not be written.
+// BatchWriteItem refuses a key repeated in one call, so a repeated key
+// starts the next chunk; chunks are written in order, so the last write of
+// a key wins.
+func (w *Worker) batchWrite(reqs []batchRequest) (failed []BatchFailure) {
+	keyNames, keyErrs := w.batchKeyNames(reqs)
+
+	var chunk []batchRequest
+	keys := map[string]bool{}
+	size := 0
+	for _, r := range reqs {
+		if err := keyErrs[r.table]; err != nil {
+			failed = append(failed, r.fail(err))
+			continue
+		}
+		if r.size > maxItemBytes {
+			failed = append(failed, r.fail(&RequestError{Kind: ErrItemTooLarge, Cause: fmt.Errorf("item size %d exceeds the limit of %d bytes", r.size, maxItemBytes)}))
+			continue
+		}
+		r.key = itemKey(r.table, writeItem(r.request), keyNames[r.table])
+		if len(chunk) == maxBatchWriteRequests || size+r.size > maxBatchWriteBytes || keys[r.key] {
+			failed = append(failed, w.writeChunk(keyNames, chunk)...)
+			chunk, keys, size = nil, map[string]bool{}, 0
+		}
+		chunk = append(chunk, r)
+		keys[r.key] = true
+		size += r.size
+	}
+	if len(chunk) > 0 {
+		failed = append(failed, w.writeChunk(keyNames, chunk)...)
+	}
+	return failed
+}
+
+// tableKeyNames caches the key attribute names that DescribeTable reports,
+// by table name, as the key schema of a table never changes.
+var tableKeyNames sync.Map
+
+// batchKeyNames returns the key attribute names of the tables that reqs
+// write, from their registered schemas or the models of their items, or
+// else from DescribeTable, which is called once per table name and needs
+// the client of w to be a SchemaAPI. It returns the errors of the tables
+// it could not describe apart.
+func (w *Worker) batchKeyNames(reqs []batchRequest) (map[string][]string, map[string]error) {
+	names := map[string][]string{}
+	for _, r := range reqs {
+		if names[r.table] != nil {
+			continue
+		}
+		if m := batchModel(r); m != nil {
+			names[r.table] = m.keyNames()
+		}
+	}
+
+	errs := map[string]error{}
+	client, isSchemaAPI := w.Client.(SchemaAPI)
+	for _, r := range reqs {
+		if names[r.table] != nil || errs[r.table] != nil {
+			continue
+		}
+		if cached, ok := tableKeyNames.Load(r.table); ok {
+			names[r.table] = cached.([]string)
+			continue
+		}
+		if !isSchemaAPI {
+			errs[r.table] = &RequestError{Kind: ErrValidation, Cause: fmt.Errorf("the key of table %s is unknown: register the table or put items with ddb tags", r.table)}
+			continue
+		}
+		desc, err := describeTable(w.ctx, client, r.table)
+		if err == nil && desc == nil {
+			err = fmt.Errorf("table %s does not exist", r.table)
+		}
+		if err != nil {
+			errs[r.table] = errors.Wrap(err, "read the key of the table failed")
+			continue
+		}
+		for _, k := range desc.KeySchema {
+			names[r.table] = append(names[r.table], aws.ToString(k.AttributeName))
+		}
+		tableKeyNames.Store(r.table, names[r.table])
+	}
+	return names, errs
+}
+
+// batchModel returns the Model of the table r writes, if it is registered,
+// or of the item r puts, if its type has ddb tags.
+func batchModel(r batchRequest) *Model {
+	if s := registeredTable(r.table); s != nil && s.Model != nil {
+		return s.Model
+	}
+	if r.request.PutRequest == nil {
+		return nil
+	}
+	m, _ := modelOf(r.source)
+	return m
+}
+
+// writeChunk writes a chunk with one BatchWriteItem call, then re-submits
+// its unprocessed requests with backoff until none are left or ctx is done.
+func (w *Worker) writeChunk(keyNames map[string][]string, pending []batchRequest) []BatchFailure {
+	for attempt := 0; ; attempt++ {
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems: make(map[string][]types.WriteRequest),
+		}
+		for _, r := range pending {
+			input.RequestItems[r.table] = append(input.RequestItems[r.table], r.request)
+		}
+
+		output, err := w.Client.BatchWriteItem(w.ctx, input)
+		if err != nil {
+			return failAll(pending, errors.Wrap(classifyError(err), "dynamodb BatchWriteItem failed"))
+		}
+
+		rest, err := unprocessedRequests(pending, output.UnprocessedItems, keyNames)
+		if err != nil {
+			return failAll(pending, errors.Wrap(err, "dynamodb BatchWriteItem failed"))
+		}
+		pending = rest
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := w.backoff().Wait(w.ctx, attempt); err != nil {
+			return failAll(pending, errors.Wrap(err, "retry unprocessed items failed"))
+		}
+	}
+}
+
+// unprocessedRequests picks the requests of pending that DynamoDB handed
+// back as unprocessed, matching them by key. An unprocessed request that
+// matches none of pending is an error, as it leaves unknown which of them
+// were written.
+func unprocessedRequests(pending []batchRequest, unprocessed map[string][]types.WriteRequest, keyNames map[string][]string) ([]batchRequest, error) {
+	byKey := make(map[string]batchRequest, len(pending))
+	for _, r := range pending {
+		byKey[r.key] = r
+	}
+
+	var rest []batchRequest
+	for table, list := range unprocessed {
+		for _, wr := range list {
+			r, ok := byKey[itemKey(table, writeItem(wr), keyNames[table])]
+			if !ok {
+				return nil, fmt.Errorf("an unprocessed request of table %s matches no request sent", table)
+			}
+			rest = append(rest, r)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].index < rest[j].index })
+	return rest, nil
+}
+
+func failAll(reqs []batchRequest, err error) []BatchFailure {
+	failed := make([]BatchFailure, len(reqs))
+	for i, r := range reqs {
+		failed[i] = r.fail(err)
+	}
+	return failed
+}
+
+// itemSize approximates the size DynamoDB accounts for an item: the lengths
+// of its attribute names and values.
+func itemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, av := range item {
+		size += len(name) + attributeSize(av)
+	}
+	return size
+}
+
+func attributeSize(av types.AttributeValue) int {
+	size := 0
+	switch v := av.(type) {
+	case *types.AttributeValueMemberB:
+		size = len(v.Value)
+	case *types.AttributeValueMemberN:
+		size = len(v.Value)
+	case *types.AttributeValueMemberS:
+		size = len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		size = 1
+	case *types.AttributeValueMemberBS:
+		for _, b := range v.Value {
+			size += len(b)
+		}
+	case *types.AttributeValueMemberNS:
+		for _, n := range v.Value {
+			size += len(n)
+		}
+	case *types.AttributeValueMemberSS:
+		for _, s := range v.Value {
+			size += len(s)
+		}
+	case *types.AttributeValueMemberM:
+		size = 3 + itemSize(v.Value)
+	case *types.AttributeValueMemberL:
+		size = 3
+		for _, e := range v.Value {
+			size += 1 + attributeSize(e)
+		}
+	}
+	return size
+}
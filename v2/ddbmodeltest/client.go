@@ -0,0 +1,19 @@
+package ddbmodeltest
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/thisissc/ddbmodel/internal/memdb"
+)
+
+// Client returns a DynamoDB client whose requests are served by db.
+// SDK retries are disabled so that tests observe every error directly.
+func (db *DB) Client() *dynamodb.Client {
+	return dynamodb.New(dynamodb.Options{
+		Region:       memdb.Region,
+		BaseEndpoint: aws.String("http://ddbmodeltest.local"),
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   db.HTTPClient(),
+		Retryer:      aws.NopRetryer{},
+	})
+}
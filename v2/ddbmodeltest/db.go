@@ -0,0 +1,78 @@
+// Package ddbmodeltest provides an in-memory DynamoDB for hermetic tests.
+//
+// A DB speaks the DynamoDB JSON 1.0 wire protocol and can be plugged into
+// an SDK client through HTTPClient, so code built on ddbmodel.Worker runs
+// against it unchanged:
+//
+//	db := ddbmodeltest.New()
+//	db.CreateTable(ddbmodeltest.TableDef{Name: "Task", HashKey: ddbmodeltest.KeyDef{Name: "ID", Type: "S"}})
+//	w := ddbmodel.NewWorker(ctx, db.Client()).Table("Task")
+//
+// Open keeps a DB in a file instead, and NewServer serves one over HTTP for
+// clients in other processes; cmd/ddblocal wraps both.
+package ddbmodeltest
+
+import "github.com/thisissc/ddbmodel/internal/memdb"
+
+// DB is an in-memory DynamoDB. All but its Client method come from the
+// engine that it shares with the ddbmodeltest of ddbmodel v1: the methods
+// CreateTable, HTTPClient and ServeHTTP, and the fields below.
+//
+// TransactionDelay keeps the items of a TransactWriteItems call locked for
+// this long between validation and commit, so that concurrent writers and
+// readers observe TransactionConflict. MaxBatchWrites and MaxBatchGets cap
+// the requests a BatchWriteItem or BatchGetItem call processes, returning
+// the rest as unprocessed; zero means no cap. IndexCreationDelay keeps a
+// global index that UpdateTable adds CREATING for this long.
+type DB struct {
+	*engine
+}
+
+// engine names memdb.DB for DB to embed it without exporting it.
+type engine = memdb.DB
+
+type (
+	// KeyDef names a key attribute and its scalar type: "S", "N" or "B".
+	KeyDef   = memdb.KeyDef
+	IndexDef = memdb.IndexDef
+	TableDef = memdb.TableDef
+)
+
+func New() *DB {
+	return &DB{memdb.New()}
+}
+
+// Open returns a DB backed by the file at path. The file is loaded when it
+// exists and rewritten after every operation that changes tables or items.
+func Open(path string) (*DB, error) {
+	db, err := memdb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db}, nil
+}
+
+// Server serves a DB over HTTP, for SDK clients and tools that cannot use
+// an in-process client.
+type Server struct {
+	// URL is the endpoint to configure in clients, e.g. through
+	// AWS_ENDPOINT_URL_DYNAMODB.
+	URL string
+	DB  *DB
+
+	srv *memdb.Server
+}
+
+// NewServer starts serving db on addr. An empty addr picks a free port on
+// the loopback interface.
+func NewServer(db *DB, addr string) (*Server, error) {
+	srv, err := memdb.NewServer(db.engine, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{URL: srv.URL, DB: db, srv: srv}, nil
+}
+
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
@@ -0,0 +1,150 @@
+package ddbmodel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+func TestClassifyError(t *testing.T) {
+	kinds := []error{ErrNotFound, ErrConditionFailed, ErrThrottled, ErrTransactionCanceled, ErrValidation, ErrItemTooLarge}
+
+	tests := []struct {
+		name  string
+		err   error
+		wants []error
+	}{
+		{
+			name:  "conditional check failures should be condition failures",
+			err:   &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")},
+			wants: []error{ErrConditionFailed},
+		},
+		{
+			name:  "exceeded throughput should be throttling",
+			err:   &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")},
+			wants: []error{ErrThrottled},
+		},
+		{
+			name:  "exceeded request limits should be throttling",
+			err:   &types.RequestLimitExceeded{Message: aws.String("slow down")},
+			wants: []error{ErrThrottled},
+		},
+		{
+			name:  "throttling exceptions should be throttling",
+			err:   &smithy.GenericAPIError{Code: "ThrottlingException", Message: "slow down"},
+			wants: []error{ErrThrottled},
+		},
+		{
+			name:  "validation exceptions should be validation failures",
+			err:   &smithy.GenericAPIError{Code: "ValidationException", Message: "One or more parameter values were invalid"},
+			wants: []error{ErrValidation},
+		},
+		{
+			name:  "oversized items should be too large and validation failures",
+			err:   &smithy.GenericAPIError{Code: "ValidationException", Message: "Item size has exceeded the maximum allowed size"},
+			wants: []error{ErrItemTooLarge, ErrValidation},
+		},
+		{
+			name:  "oversized item collections should be too large",
+			err:   &types.ItemCollectionSizeLimitExceededException{Message: aws.String("Collection size exceeded")},
+			wants: []error{ErrItemTooLarge, ErrValidation},
+		},
+		{
+			name: "canceled transactions should be canceled and condition failures when a condition failed",
+			err: &types.TransactionCanceledException{
+				Message: aws.String("Transaction cancelled"),
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")},
+				},
+			},
+			wants: []error{ErrTransactionCanceled, ErrConditionFailed},
+		},
+		{
+			name:  "unknown errors should be left alone",
+			err:   &types.ResourceNotFoundException{Message: aws.String("Requested resource not found")},
+			wants: nil,
+		},
+		{
+			name:  "errors from elsewhere should be left alone",
+			err:   fmt.Errorf("boom"),
+			wants: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := errors.Wrap(classifyError(tt.err), "request failed")
+			for _, kind := range kinds {
+				want := false
+				for _, w := range tt.wants {
+					want = want || w == kind
+				}
+				if errors.Is(err, kind) != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, kind, !want, want)
+				}
+			}
+			if !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %q does not mention its cause %q", err, tt.err)
+			}
+			var apiErr smithy.APIError
+			if _, isAPI := tt.err.(smithy.APIError); isAPI && !errors.As(err, &apiErr) {
+				t.Errorf("errors.As(%v, smithy.APIError) = false, want the cause", err)
+			}
+		})
+	}
+}
+
+func TestWorker_ErrorKinds(t *testing.T) {
+	_, client := setupMemoryDB(t)
+	seedTasks(t, client, testTask{ID: "1", Amount: 1})
+
+	tests := []struct {
+		name string
+		do   func() error
+		want error
+	}{
+		{
+			name: "getting a missing item should be not found",
+			do: func() error {
+				return NewWorker(context.Background(), client).Table(testTaskTable).Key("ID", "2").Get(&testTask{})
+			},
+			want: ErrNotFound,
+		},
+		{
+			name: "saving an oversized item should be too large",
+			do: func() error {
+				return NewWorker(context.Background(), client).Table(testTaskTable).Save(&testTask{ID: "2", TaskName: strings.Repeat("x", 400<<10)})
+			},
+			want: ErrItemTooLarge,
+		},
+		{
+			name: "batch saving an oversized item should be too large",
+			do: func() error {
+				return NewWorker(context.Background(), client).Table(testTaskTable).BatchSave([]interface{}{testTask{ID: "2", TaskName: strings.Repeat("x", 400<<10)}})
+			},
+			want: ErrItemTooLarge,
+		},
+		{
+			name: "filtering a query on a key attribute should be a validation failure",
+			do: func() error {
+				_, err := NewWorker(context.Background(), client).Table(testTaskTable).Key("ID", "1").FilterCondition(expression.Name("ID").Equal(expression.Value("1"))).Query(&[]testTask{})
+				return err
+			},
+			want: ErrValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.do(); !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -8,7 +8,9 @@ require (
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.12.14
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression v1.6.14
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.26.8
+	github.com/aws/smithy-go v1.19.0
 	github.com/pkg/errors v0.9.1
+	github.com/thisissc/ddbmodel v1.1.0
 )
 
 require (
@@ -24,6 +26,5 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sso v1.18.6 // indirect
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.21.6 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.26.7 // indirect
-	github.com/aws/smithy-go v1.19.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 )
@@ -0,0 +1,347 @@
+package ddbmodel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Model is the key schema that the ddb tags of a struct type declare:
+//
+//	type Task struct {
+//		ID    string `ddb:"pk"`
+//		Group string `ddb:"gsi=Group-Rank-index,pk"`
+//		Rank  int    `ddb:"gsi=Group-Rank-index,sk"`
+//	}
+//
+// A tag lists the keys a field is, separated by ";": "pk" and "sk" for the
+// hash and range key of the table, "gsi=Name,pk" and "gsi=Name,sk" for
+// those of a global secondary index, and "lsi=Name,sk" for the range key
+// of a local secondary index, whose hash key is that of the table. "ttl"
+// marks the attribute that the table expires items by. Key names are
+// attribute names, as the struct marshals.
+type Model struct {
+	HashKey  string
+	RangeKey string
+	// Indexes are sorted by name.
+	Indexes []ModelIndex
+	TTL     string
+
+	typ reflect.Type
+	// fields are the indexes of the key fields, by attribute name.
+	fields map[string][]int
+}
+
+type ModelIndex struct {
+	Name     string
+	Local    bool
+	HashKey  string
+	RangeKey string
+}
+
+type modelEntry struct {
+	model *Model
+	err   error
+}
+
+// models caches the Model of every struct type parsed, nil for a type
+// without ddb tags.
+var models sync.Map
+
+// ModelOf returns the Model of the struct type of v, which is a struct, a
+// pointer to one, or a slice or pointer to a slice of either.
+func ModelOf(v interface{}) (*Model, error) {
+	m, err := modelOf(v)
+	if err == nil && m == nil {
+		err = fmt.Errorf("%T has no ddb tags", v)
+	}
+	return m, err
+}
+
+// modelOf is ModelOf, but returns a nil Model for types without ddb tags.
+func modelOf(v interface{}) (*Model, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	if e, ok := models.Load(t); ok {
+		return e.(modelEntry).model, e.(modelEntry).err
+	}
+	m, err := parseModel(t)
+	if err != nil {
+		err = errors.Wrapf(err, "ddb tags of %s", t)
+	}
+	models.Store(t, modelEntry{model: m, err: err})
+	return m, err
+}
+
+func parseModel(t reflect.Type) (*Model, error) {
+	m := &Model{typ: t, fields: map[string][]int{}}
+	indexes := map[string]*ModelIndex{}
+
+	set := func(dst *string, name, what string) error {
+		if *dst != "" {
+			return fmt.Errorf("both %s and %s are the %s", *dst, name, what)
+		}
+		*dst = name
+		return nil
+	}
+
+	err := modelFields(t, nil, func(name string, index []int, tag string) error {
+		for _, spec := range strings.Split(tag, ";") {
+			var err error
+			switch spec = strings.TrimSpace(spec); {
+			case spec == "pk":
+				err = set(&m.HashKey, name, "hash key")
+			case spec == "sk":
+				err = set(&m.RangeKey, name, "range key")
+			case spec == "ttl":
+				err = set(&m.TTL, name, "TTL attribute")
+			case strings.HasPrefix(spec, "gsi="), strings.HasPrefix(spec, "lsi="):
+				parts := strings.Split(spec[len("gsi="):], ",")
+				if len(parts) != 2 || parts[0] == "" {
+					return fmt.Errorf("field %s: malformed index key %q", name, spec)
+				}
+				local := strings.HasPrefix(spec, "lsi=")
+				idx := indexes[parts[0]]
+				if idx == nil {
+					idx = &ModelIndex{Name: parts[0], Local: local}
+					indexes[parts[0]] = idx
+				}
+				switch {
+				case idx.Local != local:
+					return fmt.Errorf("index %s is both global and local", idx.Name)
+				case parts[1] == "pk" && !local:
+					err = set(&idx.HashKey, name, "hash key of "+idx.Name)
+				case parts[1] == "sk":
+					err = set(&idx.RangeKey, name, "range key of "+idx.Name)
+				default:
+					return fmt.Errorf("field %s: unknown index key %q", name, spec)
+				}
+			default:
+				return fmt.Errorf("field %s: unknown key %q", name, spec)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		m.fields[name] = index
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(m.fields) == 0 {
+		return nil, nil
+	}
+	if m.HashKey == "" {
+		return nil, errors.New("no field is the hash key")
+	}
+
+	for _, idx := range indexes {
+		if idx.Local {
+			if m.RangeKey == "" {
+				return nil, fmt.Errorf("local index %s needs a table with a range key", idx.Name)
+			}
+			idx.HashKey = m.HashKey
+		}
+		if idx.HashKey == "" {
+			return nil, fmt.Errorf("no field is the hash key of %s", idx.Name)
+		}
+		if idx.Local && idx.RangeKey == "" {
+			return nil, fmt.Errorf("no field is the range key of %s", idx.Name)
+		}
+		m.Indexes = append(m.Indexes, *idx)
+	}
+	sort.Slice(m.Indexes, func(i, j int) bool { return m.Indexes[i].Name < m.Indexes[j].Name })
+	return m, nil
+}
+
+// modelFields calls fn with every field of t, and of the structs it
+// embeds, that has a ddb tag.
+func modelFields(t reflect.Type, index []int, fn func(name string, index []int, tag string) error) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		tag, ok := sf.Tag.Lookup("ddb")
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				if err := modelFields(sf.Type, fieldIndex, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := fn(attributeName(sf), fieldIndex, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attributeName is the name sf marshals to: that of its dynamodbav tag, or
+// else the field name.
+func attributeName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("dynamodbav"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+// Key returns the key of the table that v, a struct or a pointer to one,
+// holds.
+func (m *Model) Key(v interface{}) (map[string]interface{}, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot take a key from %T", v)
+	}
+
+	key := map[string]interface{}{m.HashKey: rv.FieldByIndex(m.fields[m.HashKey]).Interface()}
+	if m.RangeKey != "" {
+		key[m.RangeKey] = rv.FieldByIndex(m.fields[m.RangeKey]).Interface()
+	}
+	return key, nil
+}
+
+// keyNames returns the attribute names of the table key.
+func (m *Model) keyNames() []string {
+	if m.RangeKey == "" {
+		return []string{m.HashKey}
+	}
+	return []string{m.HashKey, m.RangeKey}
+}
+
+// pageKeyNames returns the sorted attributes of a key that starts a page of
+// the table, or of its index indexName, whose keys include those of the
+// table. It returns nil for an index the model lacks.
+func (m *Model) pageKeyNames(indexName string) []string {
+	names := m.keyNames()
+	if indexName != "" {
+		i := sort.Search(len(m.Indexes), func(i int) bool { return m.Indexes[i].Name >= indexName })
+		if i == len(m.Indexes) || m.Indexes[i].Name != indexName {
+			return nil
+		}
+		for _, name := range []string{m.Indexes[i].HashKey, m.Indexes[i].RangeKey} {
+			if name != "" && name != m.HashKey && name != m.RangeKey {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// attributeType returns the scalar type, "S", "N" or "B", that the key
+// attribute name marshals to.
+func (m *Model) attributeType(name string) (string, error) {
+	t := m.typ.FieldByIndex(m.fields[name]).Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "S", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "N", nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "B", nil
+		}
+	case reflect.Struct:
+		if t == timeType {
+			return "S", nil
+		}
+	}
+	return "", fmt.Errorf("key %s of type %s is not a string, number or binary", name, t)
+}
+
+// index returns the name of the index whose keys are the key names, and
+// the sort key of a sort key condition if any; "" when the table keys are,
+// or no index's are.
+func (m *Model) index(keyNames []string, sortKey string) string {
+	if coversKeys(m.HashKey, m.RangeKey, keyNames, sortKey) {
+		return ""
+	}
+	for _, idx := range m.Indexes {
+		if coversKeys(idx.HashKey, idx.RangeKey, keyNames, sortKey) {
+			return idx.Name
+		}
+	}
+	return ""
+}
+
+func coversKeys(hashKey, rangeKey string, keyNames []string, sortKey string) bool {
+	if sortKey != "" && sortKey != rangeKey {
+		return false
+	}
+	hasHash := false
+	for _, name := range keyNames {
+		switch name {
+		case hashKey:
+			hasHash = true
+		case rangeKey:
+		default:
+			return false
+		}
+	}
+	return hasHash
+}
+
+// DeleteItem deletes the item whose key obj, a struct with ddb tags, holds.
+func (w *Worker) DeleteItem(obj interface{}) error {
+	if _, err := ModelOf(obj); err != nil {
+		return err
+	}
+	if err := w.keyOf(obj); err != nil {
+		return err
+	}
+	return w.Delete()
+}
+
+// keyOf sets the key that obj holds, if its type has ddb tags.
+func (w *Worker) keyOf(obj interface{}) error {
+	m, err := modelOf(obj)
+	if err != nil || m == nil {
+		return err
+	}
+	key, err := m.Key(obj)
+	if err != nil {
+		return err
+	}
+	w.Keys(key)
+	return nil
+}
+
+// modelIndex returns the index to query: the one set with Index, or else
+// the one that the ddb tags of the items of itemList declare with the keys
+// of w. It leaves w as it is, so that a reused Worker picks again.
+func (w *Worker) modelIndex(itemList interface{}) (string, error) {
+	if w.IndexName != "" || len(w.InputKey) == 0 {
+		return w.IndexName, nil
+	}
+	m, err := modelOf(itemList)
+	if err != nil || m == nil {
+		return w.IndexName, err
+	}
+
+	keyNames := make([]string, 0, len(w.InputKey))
+	for name := range w.InputKey {
+		keyNames = append(keyNames, name)
+	}
+	return m.index(keyNames, w.SortKeyName), nil
+}
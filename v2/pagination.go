@@ -0,0 +1,149 @@
+package ddbmodel
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+// pageFunc reads one page starting after esKey, with at most limit items
+// when limit is positive.
+type pageFunc func(ctx context.Context, esKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error)
+
+// QueryAll runs Query page after page and appends every item to itemList,
+// stopping early at MaxItems items or MaxPages pages. The returned offset
+// resumes after the last item read, and is empty once the results are
+// exhausted.
+func (w *Worker) QueryAll(itemList interface{}) (string, error) {
+	index, err := w.modelIndex(itemList)
+	if err != nil {
+		return "", err
+	}
+
+	page, err := w.queryPages(index)
+	if err != nil {
+		return "", err
+	}
+	return w.drainPages(itemList, page)
+}
+
+// ScanAll is QueryAll for Scan.
+func (w *Worker) ScanAll(itemList interface{}) (string, error) {
+	return w.drainPages(itemList, w.scanPages())
+}
+
+func (w *Worker) queryPages(index string) (pageFunc, error) {
+	expr, err := w.queryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, esKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+		input := w.queryInput(expr, index)
+		input.ExclusiveStartKey = esKey
+		if limit > 0 {
+			input.Limit = aws.Int32(limit)
+		}
+
+		result, err := w.Client.Query(ctx, input)
+		if err != nil {
+			return nil, nil, errors.Wrap(classifyError(err), "Query item list failed")
+		}
+		return result.Items, result.LastEvaluatedKey, nil
+	}, nil
+}
+
+func (w *Worker) scanPages() pageFunc {
+	return w.segmentPages(0, 0)
+}
+
+// segmentPages reads the pages of one segment of a parallel scan, or of the
+// whole scan when totalSegments is zero.
+func (w *Worker) segmentPages(segment, totalSegments int) pageFunc {
+	return func(ctx context.Context, esKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+		input, err := w.scanInput()
+		if err != nil {
+			return nil, nil, err
+		}
+		if totalSegments > 0 {
+			input.Segment = aws.Int32(int32(segment))
+			input.TotalSegments = aws.Int32(int32(totalSegments))
+		}
+		input.ExclusiveStartKey = esKey
+		if limit > 0 {
+			input.Limit = aws.Int32(limit)
+		}
+
+		result, err := w.Client.Scan(ctx, input)
+		if err != nil {
+			return nil, nil, errors.Wrap(classifyError(err), "Scan item list failed")
+		}
+		return result.Items, result.LastEvaluatedKey, nil
+	}
+}
+
+func (w *Worker) drainPages(itemList interface{}, page pageFunc) (string, error) {
+	ctx := w.ctx
+
+	var esKey map[string]types.AttributeValue
+	if len(w.QueryOffset) > 0 {
+		esKey = DecodeLastEvaluatedKey(w.QueryOffset)
+	}
+
+	var items []map[string]types.AttributeValue
+	for pages := 0; ; {
+		// QueryLimit stays the page size, trimmed so that no page reads
+		// past MaxItems.
+		limit := w.QueryLimit
+		if w.MaxItemCount > 0 {
+			if remaining := w.MaxItemCount - int32(len(items)); limit == 0 || remaining < limit {
+				limit = remaining
+			}
+		}
+
+		pageItems, lastKey, err := page(ctx, esKey, limit)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, pageItems...)
+		esKey = lastKey
+		pages++
+
+		if len(esKey) == 0 ||
+			w.MaxPageCount > 0 && pages >= w.MaxPageCount ||
+			w.MaxItemCount > 0 && int32(len(items)) >= w.MaxItemCount {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return "", errors.Wrap(err, "Read next page failed")
+		}
+	}
+
+	if err := appendListOfMaps(items, itemList); err != nil {
+		return "", err
+	}
+
+	offset := EncodeLastEvaluatedKey(esKey)
+	w.QueryOffset = offset
+	return offset, nil
+}
+
+// appendListOfMaps unmarshals items and appends them to the slice that
+// itemList points to.
+func appendListOfMaps(items []map[string]types.AttributeValue, itemList interface{}) error {
+	list := reflect.ValueOf(itemList)
+	if list.Kind() != reflect.Ptr || list.Elem().Kind() != reflect.Slice {
+		return errors.New("itemList must be a pointer to a slice")
+	}
+
+	decoded := reflect.New(list.Elem().Type())
+	if err := attributevalue.UnmarshalListOfMaps(items, decoded.Interface()); err != nil {
+		return errors.Wrap(err, "UnmarshalListOfMaps failed")
+	}
+	list.Elem().Set(reflect.AppendSlice(list.Elem(), decoded.Elem()))
+	return nil
+}
@@ -0,0 +1,86 @@
+package ddbmodel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SegmentCursor records how far one segment of a parallel scan has read.
+type SegmentCursor struct {
+	// Offset resumes the segment after the last item it returned.
+	Offset string
+	// Done is set once the segment has returned every item.
+	Done bool
+}
+
+// ResumeSegments makes the next ParallelScan continue from the cursors an
+// interrupted one returned.
+func (w *Worker) ResumeSegments(cursors []SegmentCursor) *Worker {
+	w.SegmentCursors = cursors
+	return w
+}
+
+// ParallelScan splits the Scan into segments and reads them in as many
+// goroutines, calling fn with each segment's iterator from that segment's
+// goroutine. The first error fn returns cancels the other segments.
+//
+// The returned cursors, one per segment, are also filled in when an error
+// stopped the scan, and resume it through ResumeSegments; segments that are
+// Done are skipped.
+func (w *Worker) ParallelScan(segments int, fn func(segment int, it *Iterator) error) ([]SegmentCursor, error) {
+	if segments < 1 {
+		return nil, errors.New("segments must be at least 1")
+	}
+	if len(w.SegmentCursors) > 0 && len(w.SegmentCursors) != segments {
+		return nil, fmt.Errorf("%d segment cursors cannot resume a scan of %d segments", len(w.SegmentCursors), segments)
+	}
+
+	cursors := make([]SegmentCursor, segments)
+	copy(cursors, w.SegmentCursors)
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	for i := range cursors {
+		if cursors[i].Done {
+			continue
+		}
+
+		it := w.newIterator(w.segmentPages(i, segments))
+		it.ctx = ctx
+		it.esKey = DecodeLastEvaluatedKey(cursors[i].Offset)
+
+		wg.Add(1)
+		go func(segment int, it *Iterator) {
+			defer wg.Done()
+
+			err := fn(segment, it)
+			if err == nil {
+				err = it.Err()
+			}
+			cursors[segment] = SegmentCursor{
+				Offset: it.Offset(),
+				Done:   err == nil && it.done(),
+			}
+
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "Scan segment %d failed", segment)
+					cancel()
+				}
+			}
+		}(i, it)
+	}
+	wg.Wait()
+	return cursors, firstErr
+}
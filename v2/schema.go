@@ -0,0 +1,533 @@
+package ddbmodel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+// TableSchema is the table that the items of a Model are kept in, as
+// CreateTableInput and EnsureTable set it up.
+type TableSchema struct {
+	Name  string
+	Model *Model
+	// BillingMode is PAY_PER_REQUEST, the default, or PROVISIONED, in
+	// which case ReadCapacity and WriteCapacity are the throughput of the
+	// table and of each of its global indexes.
+	BillingMode   types.BillingMode
+	ReadCapacity  int64
+	WriteCapacity int64
+	// Projections are the attributes that indexes project, by index name.
+	// An index without one projects all attributes.
+	Projections map[string]Projection
+	// StreamViewType enables the stream of the table with that view type
+	// when set.
+	StreamViewType types.StreamViewType
+}
+
+// Projection is the attributes an index projects: Type is ALL, KEYS_ONLY,
+// or INCLUDE with NonKeyAttributes.
+type Projection struct {
+	Type             types.ProjectionType
+	NonKeyAttributes []string
+}
+
+// NewTableSchema returns the schema of the table name for the items v,
+// whose type has ddb tags.
+func NewTableSchema(name string, v interface{}) (*TableSchema, error) {
+	m, err := ModelOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return &TableSchema{Name: name, Model: m}, nil
+}
+
+var (
+	schemasMu sync.Mutex
+	schemas   = map[string]*TableSchema{}
+)
+
+// RegisterTable adds s to the schemas that RegisteredTables lists, for the
+// tools that set up or check every table of a program.
+func RegisterTable(s *TableSchema) error {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	if _, ok := schemas[s.Name]; ok {
+		return fmt.Errorf("table %s is already registered", s.Name)
+	}
+	schemas[s.Name] = s
+	return nil
+}
+
+// RegisteredTables returns the registered schemas, sorted by table name.
+func RegisteredTables() []*TableSchema {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	list := make([]*TableSchema, 0, len(schemas))
+	for _, s := range schemas {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// registeredTable returns the registered schema of the table name, or nil.
+func registeredTable(name string) *TableSchema {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	return schemas[name]
+}
+
+// CreateTableInput returns the request that creates the table of s. The
+// TTL attribute of the model is not part of it, as DynamoDB only enables
+// TTL on an existing table.
+func (s *TableSchema) CreateTableInput() (*dynamodb.CreateTableInput, error) {
+	m := s.Model
+	attrs, err := s.attributeDefinitions(m.HashKey, m.RangeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(s.Name),
+		KeySchema:   keySchema(m.HashKey, m.RangeKey),
+		BillingMode: s.billingMode(),
+	}
+	if s.billingMode() == types.BillingModeProvisioned {
+		input.ProvisionedThroughput = s.throughput()
+	}
+	for _, idx := range m.Indexes {
+		more, err := s.attributeDefinitions(idx.HashKey, idx.RangeKey)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, more...)
+
+		if idx.Local {
+			input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, types.LocalSecondaryIndex{
+				IndexName:  aws.String(idx.Name),
+				KeySchema:  keySchema(idx.HashKey, idx.RangeKey),
+				Projection: s.projection(idx.Name),
+			})
+		} else {
+			input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, s.globalIndex(idx))
+		}
+	}
+	input.AttributeDefinitions = uniqueAttributes(attrs)
+	if s.StreamViewType != "" {
+		input.StreamSpecification = &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: s.StreamViewType,
+		}
+	}
+	return input, nil
+}
+
+func (s *TableSchema) billingMode() types.BillingMode {
+	if s.BillingMode == "" {
+		return types.BillingModePayPerRequest
+	}
+	return s.BillingMode
+}
+
+func (s *TableSchema) throughput() *types.ProvisionedThroughput {
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(s.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(s.WriteCapacity),
+	}
+}
+
+func (s *TableSchema) projection(indexName string) *types.Projection {
+	p, ok := s.Projections[indexName]
+	if !ok || p.Type == "" {
+		return &types.Projection{ProjectionType: types.ProjectionTypeAll}
+	}
+	return &types.Projection{
+		ProjectionType:   p.Type,
+		NonKeyAttributes: p.NonKeyAttributes,
+	}
+}
+
+func (s *TableSchema) globalIndex(idx ModelIndex) types.GlobalSecondaryIndex {
+	gsi := types.GlobalSecondaryIndex{
+		IndexName:  aws.String(idx.Name),
+		KeySchema:  keySchema(idx.HashKey, idx.RangeKey),
+		Projection: s.projection(idx.Name),
+	}
+	if s.billingMode() == types.BillingModeProvisioned {
+		gsi.ProvisionedThroughput = s.throughput()
+	}
+	return gsi
+}
+
+func (s *TableSchema) attributeDefinitions(names ...string) ([]types.AttributeDefinition, error) {
+	var defs []types.AttributeDefinition
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		typ, err := s.Model.attributeType(name)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, types.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: types.ScalarAttributeType(typ),
+		})
+	}
+	return defs, nil
+}
+
+func uniqueAttributes(defs []types.AttributeDefinition) []types.AttributeDefinition {
+	seen := map[string]bool{}
+	out := defs[:0]
+	for _, d := range defs {
+		if !seen[*d.AttributeName] {
+			seen[*d.AttributeName] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func keySchema(hashKey, rangeKey string) []types.KeySchemaElement {
+	ks := []types.KeySchemaElement{
+		{AttributeName: aws.String(hashKey), KeyType: types.KeyTypeHash},
+	}
+	if rangeKey != "" {
+		ks = append(ks, types.KeySchemaElement{AttributeName: aws.String(rangeKey), KeyType: types.KeyTypeRange})
+	}
+	return ks
+}
+
+// tableWaitInterval is how often EnsureTable polls a table it waits for.
+var tableWaitInterval = 2 * time.Second
+
+// EnsureTable creates the table of s if it does not exist, then adds the
+// global indexes of s that it lacks, one at a time, and enables the TTL of
+// the model, waiting for the table and its indexes to be ACTIVE. It changes
+// nothing else of an existing table; a local index it lacks is an error,
+// as DynamoDB only creates those with the table, and so is a TTL enabled
+// on another attribute.
+func EnsureTable(ctx context.Context, client SchemaAPI, s *TableSchema) error {
+	desc, err := describeTable(ctx, client, s.Name)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		input, err := s.CreateTableInput()
+		if err != nil {
+			return errors.Wrapf(err, "schema of %s", s.Name)
+		}
+		_, err = client.CreateTable(ctx, input)
+		var inUse *types.ResourceInUseException
+		if err != nil && !errors.As(err, &inUse) {
+			return requestFailed(ctx, err, "dynamodb CreateTable failed")
+		}
+	}
+	desc, err = waitTable(ctx, client, s.Name)
+	if err != nil {
+		return err
+	}
+
+	indexes := map[string]bool{}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		indexes[aws.ToString(gsi.IndexName)] = true
+	}
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		indexes[aws.ToString(lsi.IndexName)] = true
+	}
+	for _, idx := range s.Model.Indexes {
+		if indexes[idx.Name] {
+			continue
+		}
+		if idx.Local {
+			return fmt.Errorf("table %s lacks local index %s, which can only be created with the table", s.Name, idx.Name)
+		}
+		if err := addGlobalIndex(ctx, client, s, idx); err != nil {
+			return err
+		}
+	}
+
+	if s.Model.TTL == "" {
+		return nil
+	}
+	ttl, err := ttlAttribute(ctx, client, s.Name)
+	if err != nil {
+		return err
+	}
+	if ttl == s.Model.TTL {
+		return nil
+	}
+	if ttl != "" {
+		return fmt.Errorf("table %s expires items by %s, not %s, and TTL must be disabled before it can move to another attribute", s.Name, ttl, s.Model.TTL)
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(s.Name),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(s.Model.TTL),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return requestFailed(ctx, err, "dynamodb UpdateTimeToLive failed")
+	}
+	return nil
+}
+
+func addGlobalIndex(ctx context.Context, client SchemaAPI, s *TableSchema, idx ModelIndex) error {
+	attrs, err := s.attributeDefinitions(idx.HashKey, idx.RangeKey)
+	if err != nil {
+		return errors.Wrapf(err, "schema of %s", s.Name)
+	}
+	_, err = client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:            aws.String(s.Name),
+		AttributeDefinitions: uniqueAttributes(attrs),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{Create: &types.CreateGlobalSecondaryIndexAction{
+				IndexName:             aws.String(idx.Name),
+				KeySchema:             keySchema(idx.HashKey, idx.RangeKey),
+				Projection:            s.projection(idx.Name),
+				ProvisionedThroughput: s.globalIndex(idx).ProvisionedThroughput,
+			}},
+		},
+	})
+	if err != nil {
+		return requestFailed(ctx, err, fmt.Sprintf("dynamodb UpdateTable creating %s failed", idx.Name))
+	}
+	_, err = waitTable(ctx, client, s.Name)
+	return err
+}
+
+// describeTable returns the description of the table name, nil when there
+// is no such table.
+func describeTable(ctx context.Context, client SchemaAPI, name string) (*types.TableDescription, error) {
+	output, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, requestFailed(ctx, err, "dynamodb DescribeTable failed")
+	}
+	return output.Table, nil
+}
+
+// waitTable waits for the table name and its global indexes to be ACTIVE.
+func waitTable(ctx context.Context, client SchemaAPI, name string) (*types.TableDescription, error) {
+	for {
+		desc, err := describeTable(ctx, client, name)
+		if err != nil {
+			return nil, err
+		}
+		if desc != nil && tableActive(desc) {
+			return desc, nil
+		}
+
+		select {
+		case <-time.After(tableWaitInterval):
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "waiting for table %s", name)
+		}
+	}
+}
+
+func tableActive(desc *types.TableDescription) bool {
+	if desc.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if gsi.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
+
+func requestFailed(ctx context.Context, err error, message string) error {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return errors.Wrap(classifyError(err), message)
+}
+
+// SchemaDiff is how a table differs from its schema, as CheckSchema finds
+// it. It has no Differences when the table matches.
+type SchemaDiff struct {
+	Table       string
+	Differences []SchemaDifference
+}
+
+// SchemaDifference is one way a table differs from its schema: what Path
+// names is Got in the table, but Want in the schema.
+type SchemaDifference struct {
+	// Path is "Table", "KeySchema", "Attribute <name>", "Index <name>",
+	// "Index <name>.KeySchema", "Index <name>.Projection" or "TTL".
+	Path string
+	Want string
+	Got  string
+}
+
+func (d SchemaDifference) String() string {
+	return fmt.Sprintf("%s: want %s, got %s", d.Path, d.Want, d.Got)
+}
+
+func (d *SchemaDiff) String() string {
+	var b strings.Builder
+	for _, diff := range d.Differences {
+		fmt.Fprintf(&b, "%s: %s\n", d.Table, diff)
+	}
+	return b.String()
+}
+
+func (d *SchemaDiff) add(path, want, got string) {
+	if want != got {
+		d.Differences = append(d.Differences, SchemaDifference{Path: path, Want: want, Got: got})
+	}
+}
+
+// CheckSchema compares the table of s, as DescribeTable and
+// DescribeTimeToLive report it, with the keys, key attribute types,
+// indexes, projections and TTL attribute of s.
+func CheckSchema(ctx context.Context, client SchemaAPI, s *TableSchema) (*SchemaDiff, error) {
+	diff := &SchemaDiff{Table: s.Name}
+
+	desc, err := describeTable(ctx, client, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if desc == nil {
+		diff.add("Table", "present", "missing")
+		return diff, nil
+	}
+
+	m := s.Model
+	diff.add("KeySchema", keyNames(m.HashKey, m.RangeKey), describedKeys(desc.KeySchema))
+
+	attrs := map[string]string{}
+	for _, d := range desc.AttributeDefinitions {
+		attrs[aws.ToString(d.AttributeName)] = string(d.AttributeType)
+	}
+	want, err := s.CreateTableInput()
+	if err != nil {
+		return nil, errors.Wrapf(err, "schema of %s", s.Name)
+	}
+	for _, d := range want.AttributeDefinitions {
+		got, ok := attrs[*d.AttributeName]
+		if !ok {
+			got = "undefined"
+		}
+		diff.add("Attribute "+*d.AttributeName, string(d.AttributeType), got)
+	}
+
+	type described struct {
+		kind       string
+		keys       []types.KeySchemaElement
+		projection *types.Projection
+	}
+	indexes := map[string]described{}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		indexes[aws.ToString(gsi.IndexName)] = described{"global", gsi.KeySchema, gsi.Projection}
+	}
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		indexes[aws.ToString(lsi.IndexName)] = described{"local", lsi.KeySchema, lsi.Projection}
+	}
+	for _, idx := range m.Indexes {
+		path := "Index " + idx.Name
+		kind := "global"
+		if idx.Local {
+			kind = "local"
+		}
+		got, ok := indexes[idx.Name]
+		delete(indexes, idx.Name)
+		if !ok {
+			diff.add(path, kind, "missing")
+			continue
+		}
+		diff.add(path, kind, got.kind)
+		diff.add(path+".KeySchema", keyNames(idx.HashKey, idx.RangeKey), describedKeys(got.keys))
+		diff.add(path+".Projection", projectionString(s.projection(idx.Name)), projectionString(got.projection))
+	}
+	extra := make([]string, 0, len(indexes))
+	for name := range indexes {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diff.add("Index "+name, "absent", indexes[name].kind)
+	}
+
+	gotTTL, err := ttlAttribute(ctx, client, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if gotTTL == "" {
+		gotTTL = "disabled"
+	}
+	wantTTL := m.TTL
+	if wantTTL == "" {
+		wantTTL = "disabled"
+	}
+	diff.add("TTL", wantTTL, gotTTL)
+	return diff, nil
+}
+
+// ttlAttribute returns the attribute that the table name expires items by,
+// or "" when its TTL is disabled or being disabled.
+func ttlAttribute(ctx context.Context, client SchemaAPI, name string) (string, error) {
+	output, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(name)})
+	if err != nil {
+		return "", requestFailed(ctx, err, "dynamodb DescribeTimeToLive failed")
+	}
+	desc := output.TimeToLiveDescription
+	if desc == nil {
+		return "", nil
+	}
+	switch desc.TimeToLiveStatus {
+	case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+		return aws.ToString(desc.AttributeName), nil
+	}
+	return "", nil
+}
+
+func keyNames(hashKey, rangeKey string) string {
+	if rangeKey == "" {
+		return hashKey
+	}
+	return hashKey + ", " + rangeKey
+}
+
+func describedKeys(ks []types.KeySchemaElement) string {
+	var hashKey, rangeKey string
+	for _, k := range ks {
+		if k.KeyType == types.KeyTypeHash {
+			hashKey = aws.ToString(k.AttributeName)
+		} else {
+			rangeKey = aws.ToString(k.AttributeName)
+		}
+	}
+	return keyNames(hashKey, rangeKey)
+}
+
+func projectionString(p *types.Projection) string {
+	if p == nil {
+		return string(types.ProjectionTypeAll)
+	}
+	attrs := append([]string{}, p.NonKeyAttributes...)
+	if len(attrs) == 0 {
+		return string(p.ProjectionType)
+	}
+	sort.Strings(attrs)
+	return string(p.ProjectionType) + " " + strings.Join(attrs, ", ")
+}
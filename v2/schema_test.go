@@ -0,0 +1,459 @@
+package ddbmodel
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+	"github.com/thisissc/ddbmodel/v2/ddbmodeltest"
+)
+
+func TestTableSchema_CreateTableInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		setup   func(s *TableSchema)
+		want    *dynamodb.CreateTableInput
+		wantErr bool
+	}{
+		{
+			name: "global indexes should project all attributes on demand",
+			v:    testTaggedTask{},
+			want: &dynamodb.CreateTableInput{
+				TableName: aws.String("Schema"),
+				AttributeDefinitions: []types.AttributeDefinition{
+					{AttributeName: aws.String("ID"), AttributeType: types.ScalarAttributeTypeS},
+					{AttributeName: aws.String("Group"), AttributeType: types.ScalarAttributeTypeS},
+					{AttributeName: aws.String("Rank"), AttributeType: types.ScalarAttributeTypeN},
+				},
+				KeySchema:   keySchema("ID", ""),
+				BillingMode: types.BillingModePayPerRequest,
+				GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+					{
+						IndexName:  aws.String("Group-Rank-index"),
+						KeySchema:  keySchema("Group", "Rank"),
+						Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+					},
+				},
+			},
+		},
+		{
+			name: "provisioned tables should set their throughput, projections and stream",
+			v:    testTaggedRank{},
+			setup: func(s *TableSchema) {
+				s.BillingMode = "PROVISIONED"
+				s.ReadCapacity, s.WriteCapacity = 5, 1
+				s.Projections = map[string]Projection{"Group-TaskName-index": {Type: "INCLUDE", NonKeyAttributes: []string{"Amount"}}}
+				s.StreamViewType = "NEW_IMAGE"
+			},
+			want: &dynamodb.CreateTableInput{
+				TableName: aws.String("Schema"),
+				AttributeDefinitions: []types.AttributeDefinition{
+					{AttributeName: aws.String("Group"), AttributeType: types.ScalarAttributeTypeS},
+					{AttributeName: aws.String("Rank"), AttributeType: types.ScalarAttributeTypeN},
+					{AttributeName: aws.String("TaskName"), AttributeType: types.ScalarAttributeTypeS},
+				},
+				KeySchema:   keySchema("Group", "Rank"),
+				BillingMode: types.BillingModeProvisioned,
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(1),
+				},
+				LocalSecondaryIndexes: []types.LocalSecondaryIndex{
+					{
+						IndexName: aws.String("Group-TaskName-index"),
+						KeySchema: keySchema("Group", "TaskName"),
+						Projection: &types.Projection{
+							ProjectionType:   types.ProjectionTypeInclude,
+							NonKeyAttributes: []string{"Amount"},
+						},
+					},
+				},
+				StreamSpecification: &types.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: types.StreamViewTypeNewImage,
+				},
+			},
+		},
+		{
+			name: "binary and time keys should be typed as they marshal",
+			v: struct {
+				ID      []byte    `ddb:"pk"`
+				Created time.Time `ddb:"sk"`
+			}{},
+			want: &dynamodb.CreateTableInput{
+				TableName: aws.String("Schema"),
+				AttributeDefinitions: []types.AttributeDefinition{
+					{AttributeName: aws.String("ID"), AttributeType: types.ScalarAttributeTypeB},
+					{AttributeName: aws.String("Created"), AttributeType: types.ScalarAttributeTypeS},
+				},
+				KeySchema:   keySchema("ID", "Created"),
+				BillingMode: types.BillingModePayPerRequest,
+			},
+		},
+		{
+			name: "keys of other types should be refused",
+			v: struct {
+				ID   string   `ddb:"pk"`
+				Tags []string `ddb:"gsi=ByTags,pk"`
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewTableSchema("Schema", tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+			got, err := s.CreateTableInput()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTableInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateTableInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterTable(t *testing.T) {
+	s, err := NewTableSchema("RegisterTable", testTaggedTask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterTable(s); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		schemasMu.Lock()
+		delete(schemas, s.Name)
+		schemasMu.Unlock()
+	}()
+	if err := RegisterTable(&TableSchema{Name: "RegisterTable"}); err == nil {
+		t.Error("RegisterTable() of a registered name should fail")
+	}
+
+	found := false
+	for _, r := range RegisteredTables() {
+		found = found || r == s
+	}
+	if !found {
+		t.Error("RegisteredTables() should list the registered schema")
+	}
+}
+
+func TestEnsureTable(t *testing.T) {
+	defer func(d time.Duration) { tableWaitInterval = d }(tableWaitInterval)
+	tableWaitInterval = 5 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		table   string
+		v       interface{}
+		setup   func(db *ddbmodeltest.DB)
+		wantErr bool
+	}{
+		{
+			name:  "a missing table should be created",
+			table: "Schema",
+			v:     testTaggedRank{},
+		},
+		{
+			name:  "an existing table should only get its TTL enabled",
+			table: testTaskTable,
+			v:     testTaggedTask{},
+		},
+		{
+			name:  "missing global indexes should be added and waited for",
+			table: "Schema",
+			v:     testTaggedTask{},
+			setup: func(db *ddbmodeltest.DB) {
+				db.IndexCreationDelay = 50 * time.Millisecond
+				err := db.CreateTable(ddbmodeltest.TableDef{
+					Name:    "Schema",
+					HashKey: ddbmodeltest.KeyDef{Name: "ID", Type: "S"},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:    "a missing local index should fail",
+			table:   testRankTable,
+			v:       testTaggedRank{},
+			wantErr: true,
+		},
+		{
+			name:  "TTL enabled on another attribute should fail",
+			table: testTaskTable,
+			v:     testTaggedTask{},
+			setup: func(db *ddbmodeltest.DB) {
+				_, err := db.Client().UpdateTimeToLive(context.Background(), &dynamodb.UpdateTimeToLiveInput{
+					TableName: aws.String(testTaskTable),
+					TimeToLiveSpecification: &types.TimeToLiveSpecification{
+						AttributeName: aws.String("Deadline"),
+						Enabled:       aws.Bool(true),
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := setupMemoryDB(t)
+			if tt.setup != nil {
+				tt.setup(db)
+			}
+			s, err := NewTableSchema(tt.table, tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = EnsureTable(context.Background(), db.Client(), s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EnsureTable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			client := db.Client()
+			desc, err := client.DescribeTable(context.Background(), &dynamodb.DescribeTableInput{TableName: aws.String(tt.table)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tableActive(desc.Table) {
+				t.Errorf("table %s is not active", tt.table)
+			}
+			indexes := map[string]bool{}
+			for _, gsi := range desc.Table.GlobalSecondaryIndexes {
+				indexes[*gsi.IndexName] = true
+			}
+			for _, lsi := range desc.Table.LocalSecondaryIndexes {
+				indexes[*lsi.IndexName] = true
+			}
+			for _, idx := range s.Model.Indexes {
+				if !indexes[idx.Name] {
+					t.Errorf("table %s lacks index %s", tt.table, idx.Name)
+				}
+			}
+
+			ttl, err := client.DescribeTimeToLive(context.Background(), &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tt.table)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := aws.ToString(ttl.TimeToLiveDescription.AttributeName); got != s.Model.TTL {
+				t.Errorf("TTL attribute = %q, want %q", got, s.Model.TTL)
+			}
+
+			if err := EnsureTable(context.Background(), db.Client(), s); err != nil {
+				t.Errorf("EnsureTable() again error = %v", err)
+			}
+		})
+	}
+}
+
+func TestEnsureTable_Canceled(t *testing.T) {
+	db, _ := setupMemoryDB(t)
+	db.IndexCreationDelay = time.Hour
+	s, err := NewTableSchema("Schema", testTaggedTask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateTable(ddbmodeltest.TableDef{Name: "Schema", HashKey: ddbmodeltest.KeyDef{Name: "ID", Type: "S"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := EnsureTable(ctx, db.Client(), s); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EnsureTable() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		v     interface{}
+		setup func(t *testing.T, db *ddbmodeltest.DB, s *TableSchema)
+		want  []SchemaDifference
+	}{
+		{
+			name:  "a table set up by EnsureTable should match",
+			table: testTaskTable,
+			v:     testTaggedTask{},
+			setup: func(t *testing.T, db *ddbmodeltest.DB, s *TableSchema) {
+				if err := EnsureTable(context.Background(), db.Client(), s); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:  "a missing table should be reported",
+			table: "Schema",
+			v:     testTaggedTask{},
+			want:  []SchemaDifference{{Path: "Table", Want: "present", Got: "missing"}},
+		},
+		{
+			name:  "attribute types, projections, extra indexes and TTL should be compared",
+			table: "Schema",
+			v:     testTaggedTask{},
+			setup: func(t *testing.T, db *ddbmodeltest.DB, s *TableSchema) {
+				err := db.CreateTable(ddbmodeltest.TableDef{
+					Name:    "Schema",
+					HashKey: ddbmodeltest.KeyDef{Name: "ID", Type: "S"},
+					Indexes: []ddbmodeltest.IndexDef{
+						{
+							Name:       "Group-Rank-index",
+							HashKey:    ddbmodeltest.KeyDef{Name: "Group", Type: "S"},
+							RangeKey:   ddbmodeltest.KeyDef{Name: "Rank", Type: "S"},
+							Projection: "KEYS_ONLY",
+						},
+						{
+							Name:    "TaskName-index",
+							HashKey: ddbmodeltest.KeyDef{Name: "TaskName", Type: "S"},
+						},
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []SchemaDifference{
+				{Path: "Attribute Rank", Want: "N", Got: "S"},
+				{Path: "Index Group-Rank-index.Projection", Want: "ALL", Got: "KEYS_ONLY"},
+				{Path: "Index TaskName-index", Want: "absent", Got: "global"},
+				{Path: "TTL", Want: "Expires", Got: "disabled"},
+			},
+		},
+		{
+			name:  "keys and missing indexes should be compared",
+			table: testRankTable,
+			v:     testTaggedTask{},
+			want: []SchemaDifference{
+				{Path: "KeySchema", Want: "ID", Got: "Group, Rank"},
+				{Path: "Attribute ID", Want: "S", Got: "undefined"},
+				{Path: "Index Group-Rank-index", Want: "global", Got: "missing"},
+				{Path: "TTL", Want: "Expires", Got: "disabled"},
+			},
+		},
+		{
+			name:  "a missing local index should be reported",
+			table: testRankTable,
+			v:     testTaggedRank{},
+			want: []SchemaDifference{
+				{Path: "Attribute TaskName", Want: "S", Got: "undefined"},
+				{Path: "Index Group-TaskName-index", Want: "local", Got: "missing"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := setupMemoryDB(t)
+			s, err := NewTableSchema(tt.table, tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, db, s)
+			}
+
+			got, err := CheckSchema(context.Background(), db.Client(), s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Table != tt.table || !reflect.DeepEqual(got.Differences, tt.want) {
+				t.Errorf("CheckSchema() = %s, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSchemaCommand(t *testing.T) {
+	defer func(d time.Duration) { tableWaitInterval = d }(tableWaitInterval)
+	tableWaitInterval = 5 * time.Millisecond
+
+	s, err := NewTableSchema("SchemaCommand", testTaggedTask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterTable(s); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		schemasMu.Lock()
+		delete(schemas, s.Name)
+		schemasMu.Unlock()
+	}()
+
+	tests := []struct {
+		name    string
+		before  []string
+		args    []string
+		want    int
+		wantOut string
+	}{
+		{
+			name: "no command should be a usage error",
+			want: 2,
+		},
+		{
+			name: "an unknown command should be a usage error",
+			args: []string{"drop"},
+			want: 2,
+		},
+		{
+			name: "a table that is not registered should fail",
+			args: []string{"check", "-table", "Unregistered"},
+			want: 1,
+		},
+		{
+			name:    "check of a missing table should report it",
+			args:    []string{"check", "-table", s.Name},
+			want:    1,
+			wantOut: "SchemaCommand: Table: want present, got missing\n",
+		},
+		{
+			name:   "check of a table set up by ensure should pass",
+			before: []string{"ensure", "-table", s.Name},
+			args:   []string{"check", "-table", s.Name},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := setupMemoryDB(t)
+			var stdout, stderr strings.Builder
+			if tt.before != nil {
+				if got := runSchemaCommand(db.Client(), tt.before, &stdout, &stderr); got != 0 {
+					t.Fatalf("runSchemaCommand(%q) = %d, want 0; stderr %s", tt.before, got, stderr.String())
+				}
+			}
+
+			stdout.Reset()
+			if got := runSchemaCommand(db.Client(), tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("runSchemaCommand(%q) = %d, want %d; stderr %s", tt.args, got, tt.want, stderr.String())
+			}
+			if stdout.String() != tt.wantOut {
+				t.Errorf("runSchemaCommand(%q) output = %q, want %q", tt.args, stdout.String(), tt.wantOut)
+			}
+		})
+	}
+}
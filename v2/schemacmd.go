@@ -0,0 +1,111 @@
+package ddbmodel
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// RunSchemaCommand runs the schema tool over the registered tables with
+// client and returns the exit status for os.Exit. args are the command
+// line after the program name:
+//
+//	check [-table name,...] [-timeout duration]
+//	ensure [-table name,...] [-timeout duration]
+//
+// check compares every table with its model and returns 1 when any
+// differs, for deployment pipelines; ensure creates missing tables and
+// adds missing global indexes. A service builds its own tool by calling it
+// from a main package that imports its model packages, which register
+// their tables:
+//
+//	import _ "example.com/service/models"
+//
+//	func main() {
+//		cfg, err := config.LoadDefaultConfig(context.Background())
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		os.Exit(ddbmodel.RunSchemaCommand(dynamodb.NewFromConfig(cfg), os.Args[1:]))
+//	}
+func RunSchemaCommand(client SchemaAPI, args []string) int {
+	return runSchemaCommand(client, args, os.Stdout, os.Stderr)
+}
+
+// runSchemaCommand is RunSchemaCommand with the outputs given: the
+// differences check finds go to stdout, the rest to stderr.
+func runSchemaCommand(client SchemaAPI, args []string, stdout, stderr io.Writer) int {
+	if len(args) < 1 || args[0] != "check" && args[0] != "ensure" {
+		fmt.Fprintln(stderr, "usage: check|ensure [-table name,...] [-timeout duration]")
+		return 2
+	}
+	cmd := args[0]
+
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	tables := flags.String("table", "", "comma-separated tables to "+cmd+"; all registered tables when empty")
+	timeout := flags.Duration("timeout", 10*time.Minute, "time to give up after")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	schemas, err := selectTables(*tables)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	status := 0
+	for _, s := range schemas {
+		if cmd == "ensure" {
+			if err := EnsureTable(ctx, client, s); err != nil {
+				fmt.Fprintf(stderr, "failed to ensure table %s, %v\n", s.Name, err)
+				return 1
+			}
+			fmt.Fprintf(stderr, "%s: ok\n", s.Name)
+			continue
+		}
+
+		diff, err := CheckSchema(ctx, client, s)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to check table %s, %v\n", s.Name, err)
+			return 1
+		}
+		if len(diff.Differences) == 0 {
+			fmt.Fprintf(stderr, "%s: ok\n", s.Name)
+			continue
+		}
+		status = 1
+		fmt.Fprint(stdout, diff)
+	}
+	return status
+}
+
+// selectTables returns the registered schemas of the comma-separated table
+// names, or all of them.
+func selectTables(names string) ([]*TableSchema, error) {
+	all := RegisteredTables()
+	if names == "" {
+		return all, nil
+	}
+
+	byName := map[string]*TableSchema{}
+	for _, s := range all {
+		byName[s.Name] = s
+	}
+	var list []*TableSchema
+	for _, name := range strings.Split(names, ",") {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("table %s is not registered", name)
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
@@ -0,0 +1,53 @@
+package ddbmodel
+
+import "github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+
+// The SortKey methods add a condition on the sort key to the partition key
+// equality that Key sets, for Query and the functions built on it. A later
+// call replaces the condition of an earlier one.
+
+func (w *Worker) SortKeyBeginsWith(key string, prefix string) *Worker {
+	return w.sortKey(key, expression.Key(key).BeginsWith(prefix))
+}
+
+func (w *Worker) SortKeyBetween(key string, lower, upper interface{}) *Worker {
+	return w.sortKey(key, expression.Key(key).Between(expression.Value(lower), expression.Value(upper)))
+}
+
+func (w *Worker) SortKeyLessThan(key string, value interface{}) *Worker {
+	return w.sortKey(key, expression.Key(key).LessThan(expression.Value(value)))
+}
+
+func (w *Worker) SortKeyLessThanEqual(key string, value interface{}) *Worker {
+	return w.sortKey(key, expression.Key(key).LessThanEqual(expression.Value(value)))
+}
+
+func (w *Worker) SortKeyGreaterThan(key string, value interface{}) *Worker {
+	return w.sortKey(key, expression.Key(key).GreaterThan(expression.Value(value)))
+}
+
+func (w *Worker) SortKeyGreaterThanEqual(key string, value interface{}) *Worker {
+	return w.sortKey(key, expression.Key(key).GreaterThanEqual(expression.Value(value)))
+}
+
+func (w *Worker) sortKey(key string, cond expression.KeyConditionBuilder) *Worker {
+	w.SortKeyName = key
+	w.SortKeyCond = &cond
+	return w
+}
+
+// keyCondition combines the key equalities with the sort key condition.
+func (w *Worker) keyCondition() (expression.KeyConditionBuilder, bool) {
+	if len(w.InputKey) == 0 {
+		if w.SortKeyCond == nil {
+			return expression.KeyConditionBuilder{}, false
+		}
+		return *w.SortKeyCond, true
+	}
+
+	keyCond := GenKeyConditionBuilder(w.InputKey)
+	if w.SortKeyCond != nil {
+		keyCond = keyCond.And(*w.SortKeyCond)
+	}
+	return keyCond, true
+}
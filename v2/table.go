@@ -0,0 +1,77 @@
+package ddbmodel
+
+import (
+	"context"
+)
+
+// Table is a typed DAO for the items of one table, each of which decodes
+// into a T, a struct as Worker takes it:
+//
+//	tasks := ddbmodel.NewTable[Task](client, "Task")
+//	task, err := tasks.Get(ctx, map[string]interface{}{"ID": id})
+//
+// Every call runs on a new Worker for the table. The options of Query and
+// Scan set it up further, for instance:
+//
+//	tasks.Query(ctx, map[string]interface{}{"Group": g}, func(w *ddbmodel.Worker) {
+//		w.Index("Group-Rank-index").Offset(offset).Limit(20)
+//	})
+type Table[T any] struct {
+	Client DynamoDBAPI
+	Name   string
+}
+
+func NewTable[T any](client DynamoDBAPI, name string) *Table[T] {
+	return &Table[T]{
+		Client: client,
+		Name:   name,
+	}
+}
+
+// Worker starts a Worker on the table, for the operations Table does not
+// cover.
+func (t *Table[T]) Worker(ctx context.Context) *Worker {
+	return NewWorker(ctx, t.Client).Table(t.Name)
+}
+
+// Get reads the item with key. It returns ErrNotFound when there is none.
+func (t *Table[T]) Get(ctx context.Context, key map[string]interface{}, opts ...func(*Worker)) (T, error) {
+	var item T
+	err := t.worker(ctx, opts).Keys(key).Get(&item)
+	return item, err
+}
+
+// Put stores item as Worker.Save does; a Versioned item gets its new
+// version.
+func (t *Table[T]) Put(ctx context.Context, item *T, opts ...func(*Worker)) error {
+	return t.worker(ctx, opts).Save(item)
+}
+
+// Delete deletes the item with key.
+func (t *Table[T]) Delete(ctx context.Context, key map[string]interface{}, opts ...func(*Worker)) error {
+	return t.worker(ctx, opts).Keys(key).Delete()
+}
+
+// Query reads a page of the items matching key, the equalities on the hash
+// key and maybe the sort key, and returns the offset of the next page.
+func (t *Table[T]) Query(ctx context.Context, key map[string]interface{}, opts ...func(*Worker)) ([]T, string, error) {
+	var items []T
+	offset, err := t.worker(ctx, opts).Keys(key).Query(&items)
+	return items, offset, err
+}
+
+// Scan reads a page of the items of the table and returns the offset of the
+// next page.
+func (t *Table[T]) Scan(ctx context.Context, opts ...func(*Worker)) ([]T, string, error) {
+	var items []T
+	offset, err := t.worker(ctx, opts).Scan(&items)
+	return items, offset, err
+}
+
+func (t *Table[T]) worker(ctx context.Context, opts []func(*Worker)) *Worker {
+	w := t.Worker(ctx)
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
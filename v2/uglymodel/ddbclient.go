@@ -8,6 +8,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
+// DynamoDB creates a client from the default config; set
+// AWS_ENDPOINT_URL_DYNAMODB to use a local server such as cmd/ddblocal.
 func DynamoDB(ctx context.Context) *dynamodb.Client {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
@@ -3,8 +3,6 @@ package uglymodel
 import (
 	"context"
 
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pkg/errors"
 	ddbmodel "github.com/thisissc/ddbmodel/v2"
 )
@@ -28,12 +26,12 @@ type queryInput struct {
 
 type UglyDao struct {
 	ctx    context.Context
-	Client *dynamodb.Client
+	Client ddbmodel.DynamoDBAPI
 
 	queryInput queryInput
 }
 
-func NewDao(ctx context.Context, client *dynamodb.Client) UglyDao {
+func NewDao(ctx context.Context, client ddbmodel.DynamoDBAPI) UglyDao {
 	return UglyDao{
 		ctx:    ctx,
 		Client: client,
@@ -94,31 +92,20 @@ func (dao *UglyDao) Query(group string, itemList interface{}, opts ...func(*Ugly
 
 	input := dao.queryInput
 
-	kcb := expression.Key("UglyGroup").Equal(expression.Value(group))
-
-	if len(dao.queryInput.UglyId) > 0 {
-		kcb2 := expression.Key("UglyId").Equal(expression.Value(input.UglyId))
-		kcb = kcb.And(kcb2)
-	} else if len(dao.queryInput.UglyIdStartsWith) > 0 {
-		kcb2 := expression.Key("UglyId").BeginsWith(input.UglyIdStartsWith)
-		kcb = kcb.And(kcb2)
-	}
-
-	builder := expression.NewBuilder()
-	builder = builder.WithKeyCondition(kcb)
-
-	expr, err := builder.Build()
-	if err != nil {
-		return "", err
-	}
-
 	dmw := ddbmodel.NewWorker(dao.ctx, dao.Client).
 		Table(TableName).
 		Index(GroupIndexName).
+		Key("UglyGroup", group).
 		Offset(input.Offset).
 		Reverse(input.Reverse)
 
-	offset, err := dmw.QueryByExpression(expr, &itemList)
+	if len(input.UglyId) > 0 {
+		dmw.Key("UglyId", input.UglyId)
+	} else if len(input.UglyIdStartsWith) > 0 {
+		dmw.SortKeyBeginsWith("UglyId", input.UglyIdStartsWith)
+	}
+
+	offset, err := dmw.Query(itemList)
 	if err != nil {
 		return "", errors.Wrap(err, "Find error")
 	}
@@ -1,7 +1,23 @@
 package uglymodel
 
+import ddbmodel "github.com/thisissc/ddbmodel/v2"
+
 type UglyModel struct {
-	ID        string `json:"id" dynamodbav:",omitempty"`
-	UglyGroup string `json:"-" dynamodbav:",omitempty"`
-	UglyId    string `json:"-" dynamodbav:",omitempty"`
+	ID        string `json:"id" dynamodbav:",omitempty" ddb:"pk"`
+	UglyGroup string `json:"-" dynamodbav:",omitempty" ddb:"gsi=UglyGroup-UglyId-index,pk"`
+	UglyId    string `json:"-" dynamodbav:",omitempty" ddb:"gsi=UglyGroup-UglyId-index,sk"`
+}
+
+// Schema is the UglyModel table, for ddbmodel.EnsureTable.
+var Schema *ddbmodel.TableSchema
+
+func init() {
+	var err error
+	Schema, err = ddbmodel.NewTableSchema(TableName, UglyModel{})
+	if err == nil {
+		err = ddbmodel.RegisterTable(Schema)
+	}
+	if err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,96 @@
+package ddbmodel
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const VersionAttribute = "Version"
+
+// Versioned opts a model into optimistic locking when embedded next to
+// Base. Save then writes the item only if the stored version is still the
+// one loaded, bumping Version, and fails with a VersionConflictError
+// otherwise. Such a model is saved through a pointer.
+type Versioned struct {
+	Version int64 `json:"version" dynamodbav:",omitempty"`
+}
+
+func (v *Versioned) versionRef() *int64 {
+	return &v.Version
+}
+
+type versioner interface {
+	versionRef() *int64
+}
+
+var versionerType = reflect.TypeOf((*versioner)(nil)).Elem()
+
+// isVersionedValue holds if obj is a struct that embeds Versioned, rather
+// than a pointer to one, whose version Save could neither check nor bump.
+func isVersionedValue(obj interface{}) bool {
+	t := reflect.TypeOf(obj)
+	return t != nil && t.Kind() == reflect.Struct && reflect.PtrTo(t).Implements(versionerType)
+}
+
+// Version makes Update, BatchUpdate, UpdateByExpression and the functions
+// built on them apply only if the stored item is still at version, and
+// bumps the stored version by one. Along with other conditions a failure
+// is a ConditionFailedError, as it cannot tell which condition failed.
+func (w *Worker) Version(version int64) *Worker {
+	w.ExpectedVersion = &version
+	return w
+}
+
+// versionCondition holds if the stored item is at version; version 0 is an
+// item that was never saved with a version.
+func versionCondition(version int64) expression.ConditionBuilder {
+	if version == 0 {
+		return expression.Name(VersionAttribute).AttributeNotExists()
+	}
+	return expression.Name(VersionAttribute).Equal(expression.Value(version))
+}
+
+// addVersion adds the version check and bump to an update built by the
+// expression package, whose sections are one per line.
+func addVersion(input *dynamodb.UpdateItemInput, version int64) {
+	// The maps may be those of an expression the caller reuses.
+	input.ExpressionAttributeNames = copyNames(input.ExpressionAttributeNames)
+	input.ExpressionAttributeValues = copyValues(input.ExpressionAttributeValues)
+	if input.ExpressionAttributeNames == nil {
+		input.ExpressionAttributeNames = make(map[string]string)
+	}
+	if input.ExpressionAttributeValues == nil {
+		input.ExpressionAttributeValues = make(map[string]types.AttributeValue)
+	}
+	input.ExpressionAttributeNames["#ddbVersion"] = VersionAttribute
+	input.ExpressionAttributeValues[":ddbVersionIncr"] = &types.AttributeValueMemberN{Value: "1"}
+
+	lines := strings.Split(strings.TrimSpace(aws.ToString(input.UpdateExpression)), "\n")
+	added := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "ADD ") {
+			lines[i] = line + ", #ddbVersion :ddbVersionIncr"
+			added = true
+		}
+	}
+	if !added {
+		lines = append(lines, "ADD #ddbVersion :ddbVersionIncr")
+	}
+	input.UpdateExpression = aws.String(strings.TrimSpace(strings.Join(lines, "\n")))
+
+	cond := "attribute_not_exists(#ddbVersion)"
+	if version != 0 {
+		cond = "#ddbVersion = :ddbVersion"
+		input.ExpressionAttributeValues[":ddbVersion"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)}
+	}
+	if input.ConditionExpression != nil {
+		cond = "(" + *input.ConditionExpression + ") AND (" + cond + ")"
+	}
+	input.ConditionExpression = aws.String(cond)
+}
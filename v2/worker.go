@@ -3,8 +3,7 @@ package ddbmodel
 import (
 	"context"
 	"fmt"
-	"log"
-	"strings"
+	"sort"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -16,7 +15,7 @@ import (
 
 type Worker struct {
 	ctx              context.Context
-	Client           *dynamodb.Client
+	Client           DynamoDBAPI
 	TableName        string
 	IndexName        string
 	InputKey         map[string]interface{}
@@ -26,9 +25,24 @@ type Worker struct {
 	QueryLimit       int32
 	IsConsistentRead bool
 	ProjectionAttrs  []string
+	RetryBackoff     Backoff
+	BatchConcurrency int
+	KeepOrder        bool
+	MaxItemCount     int32
+	MaxPageCount     int
+	SegmentCursors   []SegmentCursor
+	SortKeyCond      *expression.KeyConditionBuilder
+	SortKeyName      string
+	FilterConds      []expression.ConditionBuilder
+	SelectMode       types.Select
+	ResultCount      int32
+	ExpectedVersion  *int64
+	WriteConds       []expression.ConditionBuilder
+	ReturnMode       types.ReturnValue
+	ReturnDst        interface{}
 }
 
-func NewWorker(ctx context.Context, client *dynamodb.Client) *Worker {
+func NewWorker(ctx context.Context, client DynamoDBAPI) *Worker {
 	return &Worker{
 		ctx:    ctx,
 		Client: client,
@@ -60,6 +74,21 @@ func (w *Worker) Reverse(reverseOrder bool) *Worker {
 	return w
 }
 
+// Select picks what a scan returns; with types.SelectCount only ResultCount
+// is filled in.
+func (w *Worker) Select(sel types.Select) *Worker {
+	w.SelectMode = sel
+	return w
+}
+
+// ReturnValues makes UpdateByExpression, the functions built on it and
+// Delete decode the attributes picked by mode into dst.
+func (w *Worker) ReturnValues(mode types.ReturnValue, dst interface{}) *Worker {
+	w.ReturnMode = mode
+	w.ReturnDst = dst
+	return w
+}
+
 func (w *Worker) ConsistentRead(isConsistentRead bool) *Worker {
 	w.IsConsistentRead = isConsistentRead
 	return w
@@ -70,6 +99,38 @@ func (w *Worker) Projection(attrs []string) *Worker {
 	return w
 }
 
+func (w *Worker) MaxItems(n int32) *Worker {
+	w.MaxItemCount = n
+	return w
+}
+
+func (w *Worker) MaxPages(n int) *Worker {
+	w.MaxPageCount = n
+	return w
+}
+
+func (w *Worker) Backoff(b Backoff) *Worker {
+	w.RetryBackoff = b
+	return w
+}
+
+func (w *Worker) backoff() Backoff {
+	if w.RetryBackoff == (Backoff{}) {
+		return DefaultBackoff
+	}
+	return w.RetryBackoff
+}
+
+func (w *Worker) Concurrency(n int) *Worker {
+	w.BatchConcurrency = n
+	return w
+}
+
+func (w *Worker) Ordered(keepOrder bool) *Worker {
+	w.KeepOrder = keepOrder
+	return w
+}
+
 func (w *Worker) Filter(key string, value interface{}) *Worker {
 	if w.InputFilter == nil {
 		w.InputFilter = make(map[string]interface{}, 0)
@@ -80,6 +141,17 @@ func (w *Worker) Filter(key string, value interface{}) *Worker {
 	return w
 }
 
+// FilterCondition adds a filter built with the expression package, such as
+//
+//	expression.Name("Rank").Between(expression.Value(1), expression.Value(5)).
+//		Or(expression.Name("TaskName").AttributeNotExists())
+//
+// to Query and Scan. Filter conditions and Filter equalities must all hold.
+func (w *Worker) FilterCondition(cond expression.ConditionBuilder) *Worker {
+	w.FilterConds = append(w.FilterConds, cond)
+	return w
+}
+
 func (w *Worker) Key(key string, value interface{}) *Worker {
 	if w.InputKey == nil {
 		w.InputKey = make(map[string]interface{}, 0)
@@ -98,71 +170,217 @@ func (w *Worker) Keys(params map[string]interface{}) *Worker {
 }
 
 func (w *Worker) Save(obj interface{}) error {
+	if v, ok := obj.(versioner); ok {
+		return w.saveVersioned(obj, v.versionRef())
+	}
+	if isVersionedValue(obj) {
+		return &RequestError{Kind: ErrValidation, Cause: fmt.Errorf("%T embeds Versioned, so Save needs a pointer to it", obj)}
+	}
+
+	av, err := attributevalue.MarshalMap(obj)
+	if err != nil {
+		return errors.Wrap(err, "attributevalue marshal failed")
+	}
+
+	return w.putItem(av, nil)
+}
+
+// saveVersioned saves obj at the next version if the stored item is still
+// at the current one, and leaves the version of obj unchanged on failure.
+func (w *Worker) saveVersioned(obj interface{}, version *int64) error {
+	loaded := *version
+	*version = loaded + 1
+
+	av, err := attributevalue.MarshalMap(obj)
+	if err != nil {
+		*version = loaded
+		return errors.Wrap(err, "attributevalue marshal failed")
+	}
+
+	cond := versionCondition(loaded)
+	if err := w.putItem(av, &cond); err != nil {
+		*version = loaded
+		return versionConflict(err, loaded, "dynamodb put item failed")
+	}
+
+	return nil
+}
+
+// Create saves obj only if no item has its key, and otherwise fails with a
+// ConditionFailedError. The key attributes are those named with Key, by the
+// registered schema of the table or by the ddb tags of obj.
+func (w *Worker) Create(obj interface{}) error {
+	av, err := attributevalue.MarshalMap(obj)
+	if err != nil {
+		return errors.Wrap(err, "attributevalue marshal failed")
+	}
+
+	exists, err := w.itemExists(obj)
+	if err != nil {
+		return err
+	}
+
+	cond := expression.Not(exists)
+	return w.putItem(av, &cond)
+}
+
+// Replace saves obj only if an item with its key exists, and otherwise
+// fails with a ConditionFailedError. It finds the key attributes as Create
+// does.
+func (w *Worker) Replace(obj interface{}) error {
+	av, err := attributevalue.MarshalMap(obj)
+	if err != nil {
+		return errors.Wrap(err, "attributevalue marshal failed")
+	}
+
+	cond, err := w.itemExists(obj)
+	if err != nil {
+		return err
+	}
+
+	return w.putItem(av, &cond)
+}
+
+// SaveIf saves obj only if the item it replaces, if any, satisfies cond,
+// and otherwise fails with a ConditionFailedError.
+func (w *Worker) SaveIf(obj interface{}, cond expression.ConditionBuilder) error {
 	av, err := attributevalue.MarshalMap(obj)
 	if err != nil {
 		return errors.Wrap(err, "attributevalue marshal failed")
 	}
 
-	_, err = w.Client.PutItem(w.ctx, &dynamodb.PutItemInput{
+	return w.putItem(av, &cond)
+}
+
+// itemExists holds if the item with the key of obj exists. The key
+// attributes are those set with Key, or else those of the registered
+// schema of the table or of the model of obj.
+func (w *Worker) itemExists(obj interface{}) (expression.ConditionBuilder, error) {
+	var names []string
+	if len(w.InputKey) > 0 {
+		for name := range w.InputKey {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else if s := registeredTable(w.TableName); s != nil && s.Model != nil {
+		names = s.Model.keyNames()
+	} else if m, err := modelOf(obj); err != nil {
+		return expression.ConditionBuilder{}, err
+	} else if m != nil {
+		names = m.keyNames()
+	}
+	if len(names) == 0 {
+		return expression.ConditionBuilder{}, &RequestError{Kind: ErrValidation, Cause: fmt.Errorf("the key of table %s is unknown: name it with Key or with ddb tags on %T", w.TableName, obj)}
+	}
+
+	cond := expression.Name(names[0]).AttributeExists()
+	for _, name := range names[1:] {
+		cond = cond.Or(expression.Name(name).AttributeExists())
+	}
+	return cond, nil
+}
+
+func (w *Worker) putItem(av map[string]types.AttributeValue, cond *expression.ConditionBuilder) error {
+	input := &dynamodb.PutItemInput{
 		TableName: aws.String(w.TableName),
 		Item:      av,
-	})
+	}
+
+	if cond != nil {
+		expr, err := expression.NewBuilder().WithCondition(*cond).Build()
+		if err != nil {
+			return errors.Wrap(err, "Build expression error")
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
 
+	_, err := w.Client.PutItem(w.ctx, input)
 	if err != nil {
-		return errors.Wrap(err, "dynamodb put item failed")
+		return errors.Wrap(classifyError(err), "dynamodb put item failed")
 	}
 
 	return nil
 }
 
-// FIXME:
-// A single call to BatchWriteItem can write up to 16 MB of data, which can comprise as many as 25 put or delete requests. Individual items to be written can be as large as 400 KB.
 func (w *Worker) BatchSave(items []interface{}) error {
-	writeRequestList := make([]types.WriteRequest, len(items))
-	for i, obj := range items {
-		av, _ := attributevalue.MarshalMap(obj)
-		wr := types.WriteRequest{
-			PutRequest: &types.PutRequest{
-				Item: av,
-			},
-		}
-		writeRequestList[i] = wr
+	bw := w.BatchWriter()
+	for _, obj := range items {
+		bw.Put(w.TableName, obj)
 	}
+	return bw.Write()
+}
 
-	input := &dynamodb.BatchWriteItemInput{
-		RequestItems: map[string][]types.WriteRequest{
-			w.TableName: writeRequestList,
-		},
+func (w *Worker) BatchDelete(keys []map[string]interface{}) error {
+	bw := w.BatchWriter()
+	for _, key := range keys {
+		bw.Delete(w.TableName, key)
 	}
+	return bw.Write()
+}
 
-	_, err := w.Client.BatchWriteItem(w.ctx, input)
+func (w *Worker) Delete() error {
+	attrs, err := w.deleteItem(w.ReturnMode)
 	if err != nil {
-		return errors.Wrap(err, "dynamodb BatchWriteItem failed")
+		return err
 	}
+	return w.decodeReturned(attrs)
+}
 
+// DeleteAndReturn deletes the item and decodes what it held into dst, or
+// returns a DdbModelEmptyError if there was no item.
+func (w *Worker) DeleteAndReturn(dst interface{}) error {
+	attrs, err := w.deleteItem(types.ReturnValueAllOld)
+	if err != nil {
+		return err
+	}
+	if len(attrs) == 0 {
+		return &DdbModelEmptyError{}
+	}
+
+	err = attributevalue.UnmarshalMap(attrs, dst)
+	if err != nil {
+		return errors.Wrap(err, "UnmarshalMap failed")
+	}
 	return nil
 }
 
-func (w *Worker) Delete() error {
+func (w *Worker) deleteItem(returnValues types.ReturnValue) (map[string]types.AttributeValue, error) {
 	key, err := attributevalue.MarshalMap(w.InputKey)
 	if err != nil {
-		return errors.Wrap(err, "MarshalMap error")
+		return nil, errors.Wrap(err, "MarshalMap error")
 	}
 
 	input := &dynamodb.DeleteItemInput{
-		Key:       key,
-		TableName: aws.String(w.TableName),
+		Key:          key,
+		ReturnValues: returnValues,
+		TableName:    aws.String(w.TableName),
 	}
 
-	_, err = w.Client.DeleteItem(w.ctx, input)
+	var cond conditionInput
+	if err := w.addWhen(&cond); err != nil {
+		return nil, err
+	}
+	input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = cond.expr, cond.names, cond.values
+
+	output, err := w.Client.DeleteItem(w.ctx, input)
 	if err != nil {
-		return errors.Wrap(err, "Delete item error")
+		return nil, errors.Wrap(classifyError(err), "Delete item error")
 	}
 
-	return nil
+	return output.Attributes, nil
 }
 
+// Get reads the item with the key set with Key into dst; without one, the
+// key is the one dst holds, if its type has ddb tags.
 func (w *Worker) Get(dst interface{}) error {
+	if len(w.InputKey) == 0 {
+		if err := w.keyOf(dst); err != nil {
+			return err
+		}
+	}
+
 	key, err := attributevalue.MarshalMap(w.InputKey)
 	if err != nil {
 		return errors.Wrap(err, "MarshalMap error")
@@ -176,7 +394,7 @@ func (w *Worker) Get(dst interface{}) error {
 
 	result, err := w.Client.GetItem(w.ctx, input)
 	if err != nil {
-		return errors.Wrap(err, "Get item error")
+		return errors.Wrap(classifyError(err), "Get item error")
 	}
 
 	if len(result.Item) > 0 {
@@ -191,64 +409,53 @@ func (w *Worker) Get(dst interface{}) error {
 	return nil
 }
 
-// FIXME:
-// A single operation can retrieve up to 16 MB of data, which can contain as many as 100 items.
 func (w *Worker) BatchGet(pkName string, ids []string, itemList interface{}) error {
-	keys := make([]map[string]types.AttributeValue, len(ids))
+	keys := make([]map[string]interface{}, len(ids))
 	for i, id := range ids {
-		curKey := map[string]types.AttributeValue{
-			pkName: &types.AttributeValueMemberS{
-				Value: id,
-			},
-		}
-		keys[i] = curKey
+		keys[i] = map[string]interface{}{pkName: id}
 	}
 
-	keysAndAttrs := types.KeysAndAttributes{
-		Keys: keys,
-	}
+	_, err := w.BatchGetKeys(keys, itemList)
+	return err
+}
 
-	projLen := len(w.ProjectionAttrs)
-	if projLen > 0 {
-		expAttrNames := make([]string, projLen)
-		expAttrNameMap := make(map[string]string, projLen)
-		for i, name := range w.ProjectionAttrs {
-			aliasName := fmt.Sprintf("#EAN%d", i)
-			expAttrNames[i] = aliasName
-			expAttrNameMap[aliasName] = name
-		}
-		keysAndAttrs.ExpressionAttributeNames = expAttrNameMap
-		keysAndAttrs.ProjectionExpression = aws.String(strings.Join(expAttrNames, ","))
+// Query reads a page of the items with the key set with Key into itemList.
+// Without an Index, it queries the index that ddb tags of the items
+// declare with those keys, if any.
+func (w *Worker) Query(itemList interface{}) (string, error) {
+	index, err := w.modelIndex(itemList)
+	if err != nil {
+		return "", err
 	}
 
-	input := &dynamodb.BatchGetItemInput{
-		RequestItems: map[string]types.KeysAndAttributes{
-			w.TableName: keysAndAttrs,
-		},
+	expr, err := w.queryExpression()
+	if err != nil {
+		return "", err
 	}
 
-	resp, err := w.Client.BatchGetItem(w.ctx, input)
+	return w.query(expr, index, itemList)
+}
 
-	if err != nil {
-		log.Println(err)
-		return errors.Wrap(err, "Client failed")
+// filterCondition ANDs the Filter equalities and the filter conditions.
+func (w *Worker) filterCondition() (expression.ConditionBuilder, bool) {
+	conds := w.FilterConds
+	if len(w.InputFilter) > 0 {
+		conds = append([]expression.ConditionBuilder{GenConditionBuilder(w.InputFilter)}, conds...)
 	}
 
-	if values, ok := resp.Responses[w.TableName]; ok {
-		err = attributevalue.UnmarshalListOfMaps(values, itemList)
-
-		if err != nil {
-			return errors.Wrap(err, "UnmarshalListOfMaps failed")
-		}
+	switch len(conds) {
+	case 0:
+		return expression.ConditionBuilder{}, false
+	case 1:
+		return conds[0], true
 	}
-	return nil
+	return expression.And(conds[0], conds[1], conds[2:]...), true
 }
 
-func (w *Worker) Query(itemList interface{}) (string, error) {
+func (w *Worker) queryExpression() (expression.Expression, error) {
 	builder := expression.NewBuilder()
 
-	if len(w.InputKey) > 0 {
-		keyCond := GenKeyConditionBuilder(w.InputKey)
+	if keyCond, ok := w.keyCondition(); ok {
 		builder = builder.WithKeyCondition(keyCond)
 	}
 
@@ -264,20 +471,50 @@ func (w *Worker) Query(itemList interface{}) (string, error) {
 		builder = builder.WithProjection(proj)
 	}
 
-	if len(w.InputFilter) > 0 {
-		condBuilder := GenConditionBuilder(w.InputFilter)
+	if condBuilder, ok := w.filterCondition(); ok {
 		builder = builder.WithFilter(condBuilder)
 	}
 
 	expr, err := builder.Build()
 	if err != nil {
-		return "", errors.Wrap(err, "Build expression error")
+		return expr, errors.Wrap(err, "Build expression error")
 	}
-
-	return w.QueryByExpression(expr, itemList)
+	return expr, nil
 }
 
 func (w *Worker) QueryByExpression(expr expression.Expression, itemList interface{}) (string, error) {
+	return w.query(expr, w.IndexName, itemList)
+}
+
+// query is QueryByExpression on index.
+func (w *Worker) query(expr expression.Expression, index string, itemList interface{}) (string, error) {
+	input := w.queryInput(expr, index)
+
+	if w.QueryLimit > 0 {
+		input.Limit = aws.Int32(w.QueryLimit)
+	}
+
+	offset := ""
+
+	result, err := w.Client.Query(w.ctx, input)
+	if err != nil {
+		return offset, errors.Wrap(classifyError(err), "Query item list failed")
+	}
+
+	if len(result.Items) > 0 {
+		err = attributevalue.UnmarshalListOfMaps(result.Items, itemList)
+		if err != nil {
+			return offset, errors.Wrap(err, "UnmarshalListOfMaps failed")
+		} else {
+			offset = EncodeLastEvaluatedKey(result.LastEvaluatedKey)
+			w.QueryOffset = offset
+		}
+	}
+
+	return offset, nil
+}
+
+func (w *Worker) queryInput(expr expression.Expression, index string) *dynamodb.QueryInput {
 	input := &dynamodb.QueryInput{
 		KeyConditionExpression:    expr.KeyCondition(),
 		ExpressionAttributeNames:  expr.Names(),
@@ -287,8 +524,8 @@ func (w *Worker) QueryByExpression(expr expression.Expression, itemList interfac
 		TableName:                 aws.String(w.TableName),
 	}
 
-	if len(w.IndexName) > 0 {
-		input.IndexName = aws.String(w.IndexName)
+	if len(index) > 0 {
+		input.IndexName = aws.String(index)
 	}
 
 	if len(w.QueryOffset) > 0 {
@@ -302,15 +539,24 @@ func (w *Worker) QueryByExpression(expr expression.Expression, itemList interfac
 		input.ScanIndexForward = aws.Bool(false)
 	}
 
+	return input
+}
+
+func (w *Worker) Scan(itemList interface{}) (string, error) {
+	input, err := w.scanInput()
+	if err != nil {
+		return "", err
+	}
+
 	if w.QueryLimit > 0 {
 		input.Limit = aws.Int32(w.QueryLimit)
 	}
 
 	offset := ""
 
-	result, err := w.Client.Query(w.ctx, input)
+	result, err := w.Client.Scan(w.ctx, input)
 	if err != nil {
-		return offset, errors.Wrap(err, "Query item list failed")
+		return offset, errors.Wrap(classifyError(err), "Scan item list failed")
 	}
 
 	if len(result.Items) > 0 {
@@ -326,11 +572,37 @@ func (w *Worker) QueryByExpression(expr expression.Expression, itemList interfac
 	return offset, nil
 }
 
-func (w *Worker) Scan(itemList interface{}) (string, error) {
-	input := &dynamodb.ScanInput{
-		TableName: aws.String(w.TableName),
+// ScanByExpression is Scan with a hand-built filter and projection; the
+// index, offset, limit, Select and ConsistentRead settings of w still apply.
+// The offset is returned whenever there are more items, even after a page
+// without matches.
+func (w *Worker) ScanByExpression(expr expression.Expression, itemList interface{}) (string, error) {
+	input := w.scanExpressionInput(expr)
+
+	if w.QueryLimit > 0 {
+		input.Limit = aws.Int32(w.QueryLimit)
 	}
 
+	result, err := w.Client.Scan(w.ctx, input)
+	if err != nil {
+		return "", errors.Wrap(classifyError(err), "Scan item list failed")
+	}
+
+	if len(result.Items) > 0 {
+		err = attributevalue.UnmarshalListOfMaps(result.Items, itemList)
+		if err != nil {
+			return "", errors.Wrap(err, "UnmarshalListOfMaps failed")
+		}
+	}
+
+	w.ResultCount = result.Count
+	w.QueryOffset = EncodeLastEvaluatedKey(result.LastEvaluatedKey)
+	return w.QueryOffset, nil
+}
+
+func (w *Worker) scanInput() (*dynamodb.ScanInput, error) {
+	var expr expression.Expression
+
 	builderSeted := false
 
 	builder := expression.NewBuilder()
@@ -349,23 +621,30 @@ func (w *Worker) Scan(itemList interface{}) (string, error) {
 		builderSeted = true
 	}
 
-	if len(w.InputFilter) > 0 {
-		condBuilder := GenConditionBuilder(w.InputFilter)
+	if condBuilder, ok := w.filterCondition(); ok {
 		builder = builder.WithFilter(condBuilder)
 
 		builderSeted = true
 	}
 
 	if builderSeted {
-		expr, err := builder.Build()
+		var err error
+		expr, err = builder.Build()
 		if err != nil {
-			return "", errors.Wrap(err, "Build expression error")
+			return nil, errors.Wrap(err, "Build expression error")
 		}
+	}
 
-		input.ExpressionAttributeNames = expr.Names()
-		input.ExpressionAttributeValues = expr.Values()
-		input.FilterExpression = expr.Filter()
-		input.ProjectionExpression = expr.Projection()
+	return w.scanExpressionInput(expr), nil
+}
+
+func (w *Worker) scanExpressionInput(expr expression.Expression) *dynamodb.ScanInput {
+	input := &dynamodb.ScanInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		TableName:                 aws.String(w.TableName),
 	}
 
 	if len(w.IndexName) > 0 {
@@ -379,28 +658,15 @@ func (w *Worker) Scan(itemList interface{}) (string, error) {
 		}
 	}
 
-	if w.QueryLimit > 0 {
-		input.Limit = aws.Int32(w.QueryLimit)
+	if len(w.SelectMode) > 0 {
+		input.Select = w.SelectMode
 	}
 
-	offset := ""
-
-	result, err := w.Client.Scan(w.ctx, input)
-	if err != nil {
-		return offset, errors.Wrap(err, "Scan item list failed")
+	if w.IsConsistentRead {
+		input.ConsistentRead = aws.Bool(true)
 	}
 
-	if len(result.Items) > 0 {
-		err = attributevalue.UnmarshalListOfMaps(result.Items, itemList)
-		if err != nil {
-			return offset, errors.Wrap(err, "UnmarshalListOfMaps failed")
-		} else {
-			offset = EncodeLastEvaluatedKey(result.LastEvaluatedKey)
-			w.QueryOffset = offset
-		}
-	}
-
-	return offset, nil
+	return input
 }
 
 func (w *Worker) Incr(key string, increment int64) error {
@@ -416,6 +682,30 @@ func (w *Worker) Incr(key string, increment int64) error {
 	return w.UpdateByExpression(expr)
 }
 
+// IncrAndGet is Incr that returns the incremented value.
+func (w *Worker) IncrAndGet(key string, increment int64) (int64, error) {
+	update := expression.Add(
+		expression.Name(key),
+		expression.Value(increment),
+	)
+
+	expr, _ := expression.NewBuilder().
+		WithUpdate(update).
+		Build()
+
+	attrs, err := w.updateItem(expr, types.ReturnValueUpdatedNew)
+	if err != nil {
+		return 0, err
+	}
+
+	var value int64
+	err = attributevalue.Unmarshal(attrs[key], &value)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unmarshal failed")
+	}
+	return value, nil
+}
+
 func (w *Worker) Add2Set(key string, values []string) error {
 	update := expression.Add(
 		expression.Name(key),
@@ -473,24 +763,69 @@ func (w *Worker) BatchUpdate(data map[string]interface{}) error {
 }
 
 func (w *Worker) UpdateByExpression(expr expression.Expression) error {
+	attrs, err := w.updateItem(expr, w.ReturnMode)
+	if err != nil {
+		return err
+	}
+	return w.decodeReturned(attrs)
+}
+
+func (w *Worker) updateItem(expr expression.Expression, returnValues types.ReturnValue) (map[string]types.AttributeValue, error) {
 	key, err := attributevalue.MarshalMap(w.InputKey)
 	if err != nil {
-		return errors.Wrap(err, "MarshalMap error")
+		return nil, errors.Wrap(err, "MarshalMap error")
+	}
+
+	if len(returnValues) == 0 {
+		returnValues = types.ReturnValueNone
 	}
 
 	input := &dynamodb.UpdateItemInput{
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
 		Key:                       key,
-		ReturnValues:              types.ReturnValueNone,
+		ReturnValues:              returnValues,
 		TableName:                 aws.String(w.TableName),
 	}
 
-	_, err = w.Client.UpdateItem(w.ctx, input)
+	cond := conditionInput{input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues}
+	if err := w.addWhen(&cond); err != nil {
+		return nil, err
+	}
+	input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = cond.expr, cond.names, cond.values
+
+	// A failure is only known to be a version conflict if the version is
+	// the sole condition.
+	versionOnly := w.ExpectedVersion != nil && input.ConditionExpression == nil
+	if w.ExpectedVersion != nil {
+		addVersion(input, *w.ExpectedVersion)
+	}
+
+	output, err := w.Client.UpdateItem(w.ctx, input)
 	if err != nil {
-		return errors.Wrap(err, "Query item list failed")
+		err = errors.Wrap(classifyError(err), "dynamodb update item failed")
+		if versionOnly {
+			err = versionConflict(err, *w.ExpectedVersion, "dynamodb update item failed")
+		}
+		return nil, err
 	}
 
+	return output.Attributes, nil
+}
+
+// decodeReturned decodes the attributes an update or delete returned into
+// the destination set with ReturnValues. Nothing is decoded when there are
+// none, such as the old values of an item that did not exist.
+func (w *Worker) decodeReturned(attrs map[string]types.AttributeValue) error {
+	if w.ReturnDst == nil || len(attrs) == 0 {
+		return nil
+	}
+
+	err := attributevalue.UnmarshalMap(attrs, w.ReturnDst)
+	if err != nil {
+		return errors.Wrap(err, "UnmarshalMap failed")
+	}
 	return nil
 }
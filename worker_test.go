@@ -0,0 +1,2722 @@
+package ddbmodel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/pkg/errors"
+	"github.com/thisissc/ddbmodel/ddbmodeltest"
+)
+
+const (
+	testTaskTable      = "Task"
+	testTaskGroupIndex = "Group-Rank-index"
+	testRankTable      = "TaskRank"
+)
+
+type testTask struct {
+	Base
+
+	ID       string   `dynamodbav:",omitempty"`
+	Group    string   `dynamodbav:",omitempty"`
+	Rank     int      `dynamodbav:",omitempty"`
+	TaskName string   `dynamodbav:",omitempty"`
+	Amount   int64    `dynamodbav:",omitempty"`
+	Tags     []string `dynamodbav:",stringset,omitempty"`
+}
+
+func setupMemoryDB(t *testing.T) (*ddbmodeltest.DB, *session.Session) {
+	db := ddbmodeltest.New()
+	err := db.CreateTable(ddbmodeltest.TableDef{
+		Name:    testTaskTable,
+		HashKey: ddbmodeltest.KeyDef{Name: "ID", Type: "S"},
+		Indexes: []ddbmodeltest.IndexDef{
+			{
+				Name:     testTaskGroupIndex,
+				HashKey:  ddbmodeltest.KeyDef{Name: "Group", Type: "S"},
+				RangeKey: ddbmodeltest.KeyDef{Name: "Rank", Type: "N"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateTable(ddbmodeltest.TableDef{
+		Name:     testRankTable,
+		HashKey:  ddbmodeltest.KeyDef{Name: "Group", Type: "S"},
+		RangeKey: ddbmodeltest.KeyDef{Name: "Rank", Type: "N"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, db.Session()
+}
+
+func seedTasks(t *testing.T, sess *session.Session, tasks ...testTask) {
+	for i := range tasks {
+		if err := NewWorker(sess, testTaskTable).Save(&tasks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWorker_SaveAndGet(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess, testTask{ID: "1", Group: "g", Rank: 1, TaskName: "first"})
+
+	tests := []struct {
+		name    string
+		id      string
+		want    testTask
+		wantErr error
+	}{
+		{
+			name: "existing item should be returned",
+			id:   "1",
+			want: testTask{ID: "1", Group: "g", Rank: 1, TaskName: "first"},
+		},
+		{
+			name:    "missing item should return DdbModelEmptyError",
+			id:      "2",
+			wantErr: &DdbModelEmptyError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testTask
+			err := NewWorker(sess, testTaskTable).Key("ID", tt.id).Get(&got)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Worker.Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Worker.Get() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorker_ConditionalSave(t *testing.T) {
+	tests := []struct {
+		name       string
+		save       func(w *Worker) error
+		wantFailed bool
+		wantErr    error
+		want       testTask
+	}{
+		{
+			name:       "create should refuse to overwrite an item",
+			save:       func(w *Worker) error { return w.Create(&testTaggedTask{ID: "1", TaskName: "new"}) },
+			wantFailed: true,
+			want:       testTask{ID: "1", TaskName: "old", Amount: 1},
+		},
+		{
+			name: "create should store a new item",
+			save: func(w *Worker) error { return w.Create(&testTaggedTask{ID: "2", TaskName: "new"}) },
+			want: testTask{ID: "2", TaskName: "new"},
+		},
+		{
+			name:       "create with key names should refuse to overwrite an item",
+			save:       func(w *Worker) error { return w.Key("ID", "1").Create(&testTask{ID: "1", TaskName: "new"}) },
+			wantFailed: true,
+			want:       testTask{ID: "1", TaskName: "old", Amount: 1},
+		},
+		{
+			name:    "create without a known key should ask for one",
+			save:    func(w *Worker) error { return w.Create(&testTask{ID: "2", TaskName: "new"}) },
+			wantErr: ErrValidation,
+		},
+		{
+			name: "replace should overwrite an item",
+			save: func(w *Worker) error { return w.Replace(&testTaggedTask{ID: "1", TaskName: "new"}) },
+			want: testTask{ID: "1", TaskName: "new"},
+		},
+		{
+			name:       "replace should refuse to create an item",
+			save:       func(w *Worker) error { return w.Replace(&testTaggedTask{ID: "2", TaskName: "new"}) },
+			wantFailed: true,
+		},
+		{
+			name: "save if should overwrite an item that satisfies the condition",
+			save: func(w *Worker) error {
+				return w.SaveIf(&testTask{ID: "1", TaskName: "new"}, expression.Name("Amount").LessThan(expression.Value(2)))
+			},
+			want: testTask{ID: "1", TaskName: "new"},
+		},
+		{
+			name: "save if should refuse to overwrite an item that fails the condition",
+			save: func(w *Worker) error {
+				return w.SaveIf(&testTask{ID: "1", TaskName: "new"}, expression.Name("Amount").GreaterThan(expression.Value(2)))
+			},
+			wantFailed: true,
+			want:       testTask{ID: "1", TaskName: "old", Amount: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			seedTasks(t, sess, testTask{ID: "1", TaskName: "old", Amount: 1})
+
+			err := tt.save(NewWorker(sess, testTaskTable))
+			var condErr *ConditionFailedError
+			if errors.Is(err, ErrConditionFailed) != tt.wantFailed || errors.As(err, &condErr) != tt.wantFailed {
+				t.Fatalf("save error = %v, wantFailed %v", err, tt.wantFailed)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save error = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.wantFailed && tt.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			var got testTask
+			if tt.want.ID != "" {
+				if err := NewWorker(sess, testTaskTable).Key("ID", tt.want.ID).Get(&got); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stored item = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type testVersionedTask struct {
+	Base
+	Versioned
+
+	ID       string `dynamodbav:",omitempty"`
+	TaskName string `dynamodbav:",omitempty"`
+	Amount   int64  `dynamodbav:",omitempty"`
+}
+
+func TestWorker_Versioned(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	task := func() *Worker { return NewWorker(sess, testTaskTable).Key("ID", "1") }
+	first := testVersionedTask{ID: "1", TaskName: "first"}
+	var stale testVersionedTask
+
+	// The steps run in order against the same item.
+	steps := []struct {
+		name         string
+		write        func() error
+		wantConflict bool
+		wantErr      error
+		wantVersion  int64
+	}{
+		{
+			name:        "saving a new item should store version 1",
+			write:       func() error { return NewWorker(sess, testTaskTable).Save(&first) },
+			wantVersion: 1,
+		},
+		{
+			name: "saving the loaded version should bump it",
+			write: func() error {
+				stale = first
+				first.TaskName = "second"
+				return NewWorker(sess, testTaskTable).Save(&first)
+			},
+			wantVersion: 2,
+		},
+		{
+			name:         "saving a stale version should conflict",
+			write:        func() error { return NewWorker(sess, testTaskTable).Save(&stale) },
+			wantConflict: true,
+			wantVersion:  2,
+		},
+		{
+			name:        "updating the loaded version should bump it",
+			write:       func() error { return task().Version(2).Update("TaskName", "third") },
+			wantVersion: 3,
+		},
+		{
+			name:         "updating a stale version should conflict",
+			write:        func() error { return task().Version(2).Update("TaskName", "fourth") },
+			wantConflict: true,
+			wantVersion:  3,
+		},
+		{
+			name:        "incrementing the loaded version should bump it",
+			write:       func() error { return task().Version(3).Incr("Amount", 5) },
+			wantVersion: 4,
+		},
+		{
+			name:         "batch updating a stale version should conflict",
+			write:        func() error { return task().Version(3).BatchUpdate(map[string]interface{}{"TaskName": "fifth"}) },
+			wantConflict: true,
+			wantVersion:  4,
+		},
+		{
+			name:        "updating without a version should leave it alone",
+			write:       func() error { return task().Update("TaskName", "sixth") },
+			wantVersion: 4,
+		},
+		{
+			name:        "saving a stale value should be refused",
+			write:       func() error { return NewWorker(sess, testTaskTable).Save(stale) },
+			wantErr:     ErrValidation,
+			wantVersion: 4,
+		},
+		{
+			name: "an expression reused after a versioned update should not keep the version check",
+			write: func() error {
+				expr, err := expression.NewBuilder().
+					WithUpdate(expression.Set(expression.Name("TaskName"), expression.Value("seventh"))).
+					Build()
+				if err != nil {
+					return err
+				}
+				if err := task().Version(4).UpdateByExpression(expr); err != nil {
+					return err
+				}
+				return task().UpdateByExpression(expr)
+			},
+			wantVersion: 5,
+		},
+	}
+	for _, step := range steps {
+		err := step.write()
+		var conflict *VersionConflictError
+		isConflict := errors.Is(err, ErrVersionConflict) && errors.Is(err, ErrConditionFailed) && errors.As(err, &conflict)
+		if isConflict != step.wantConflict || !step.wantConflict && !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: error = %v, wantConflict %v, wantErr %v", step.name, err, step.wantConflict, step.wantErr)
+		}
+
+		var got testVersionedTask
+		if err := task().Get(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Version != step.wantVersion {
+			t.Errorf("%s: stored version = %d, want %d", step.name, got.Version, step.wantVersion)
+		}
+	}
+	if stale.Version != 1 {
+		t.Errorf("version after a conflicting Save = %d, want it unchanged at 1", stale.Version)
+	}
+}
+
+type testTaggedTask struct {
+	Base
+
+	ID       string `ddb:"pk" dynamodbav:",omitempty"`
+	Group    string `ddb:"gsi=Group-Rank-index,pk" dynamodbav:",omitempty"`
+	Rank     int    `ddb:"gsi=Group-Rank-index,sk" dynamodbav:",omitempty"`
+	TaskName string `dynamodbav:",omitempty"`
+	Expires  int64  `ddb:"ttl" dynamodbav:",omitempty"`
+}
+
+type testTaggedRank struct {
+	Group    string `ddb:"pk"`
+	Rank     int    `ddb:"sk"`
+	TaskName string `ddb:"lsi=Group-TaskName-index,sk" dynamodbav:",omitempty"`
+}
+
+func TestModelOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    *Model
+		wantErr bool
+	}{
+		{
+			name: "table and global index keys should be read",
+			v:    &[]testTaggedTask{},
+			want: &Model{
+				HashKey: "ID",
+				Indexes: []ModelIndex{{Name: "Group-Rank-index", HashKey: "Group", RangeKey: "Rank"}},
+				TTL:     "Expires",
+			},
+		},
+		{
+			name: "a local index should share the hash key of the table",
+			v:    testTaggedRank{},
+			want: &Model{
+				HashKey:  "Group",
+				RangeKey: "Rank",
+				Indexes:  []ModelIndex{{Name: "Group-TaskName-index", Local: true, HashKey: "Group", RangeKey: "TaskName"}},
+			},
+		},
+		{
+			name: "keys should be named as they marshal",
+			v: struct {
+				ID    string `json:"id" ddb:"pk"`
+				Sort  string `dynamodbav:"sort" json:"s" ddb:"sk;gsi=BySort,pk"`
+				Other string `json:"other,omitempty" dynamodbav:",omitempty" ddb:"gsi=BySort,sk"`
+			}{},
+			want: &Model{
+				HashKey:  "id",
+				RangeKey: "sort",
+				Indexes:  []ModelIndex{{Name: "BySort", HashKey: "sort", RangeKey: "Other"}},
+			},
+		},
+		{
+			name:    "a type without ddb tags should have no model",
+			v:       testTask{},
+			wantErr: true,
+		},
+		{
+			name: "two hash keys should be refused",
+			v: struct {
+				A string `ddb:"pk"`
+				B string `ddb:"pk"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "a model without a hash key should be refused",
+			v: struct {
+				A string `ddb:"sk"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "a global index without a hash key should be refused",
+			v: struct {
+				A string `ddb:"pk"`
+				B string `ddb:"gsi=ByB,sk"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "a local index on a table without a range key should be refused",
+			v: struct {
+				A string `ddb:"pk"`
+				B string `ddb:"lsi=ByB,sk"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unknown keys should be refused",
+			v: struct {
+				A string `ddb:"pk"`
+				B string `ddb:"lsi=ByB,pk"`
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ModelOf(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ModelOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.HashKey != tt.want.HashKey || got.RangeKey != tt.want.RangeKey || got.TTL != tt.want.TTL || !reflect.DeepEqual(got.Indexes, tt.want.Indexes) {
+				t.Errorf("ModelOf() = %+v, want %+v", got, tt.want)
+			}
+			if again, _ := ModelOf(tt.v); again != got {
+				t.Errorf("ModelOf() parsed %T again", tt.v)
+			}
+		})
+	}
+}
+
+func TestWorker_ModelKeys(t *testing.T) {
+	const rankNameTable = "TaskRankName"
+
+	tests := []struct {
+		name    string
+		run     func(sess *session.Session) ([]string, error)
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "Get should read the item with the key of its destination",
+			run: func(sess *session.Session) ([]string, error) {
+				task := testTaggedTask{ID: "2"}
+				err := NewWorker(sess, testTaskTable).Get(&task)
+				return []string{task.ID, task.TaskName}, err
+			},
+			want: []string{"2", "second"},
+		},
+		{
+			name: "Get with a key should not use that of its destination",
+			run: func(sess *session.Session) ([]string, error) {
+				task := testTaggedTask{ID: "2"}
+				err := NewWorker(sess, testTaskTable).Key("ID", "1").Get(&task)
+				return []string{task.ID, task.TaskName}, err
+			},
+			want: []string{"1", "first"},
+		},
+		{
+			name: "DeleteItem should delete the item with the key it holds",
+			run: func(sess *session.Session) ([]string, error) {
+				if err := NewWorker(sess, testTaskTable).DeleteItem(testTaggedTask{ID: "1", TaskName: "ignored"}); err != nil {
+					return nil, err
+				}
+				var tasks []testTaggedTask
+				_, err := NewWorker(sess, testTaskTable).Scan(&tasks)
+				ids := make([]string, len(tasks))
+				for i, task := range tasks {
+					ids[i] = task.ID
+				}
+				sort.Strings(ids)
+				return ids, err
+			},
+			want: []string{"2", "3"},
+		},
+		{
+			name: "DeleteItem of a type without ddb tags should fail",
+			run: func(sess *session.Session) ([]string, error) {
+				return nil, NewWorker(sess, testTaskTable).DeleteItem(testTask{ID: "1"})
+			},
+			wantErr: errors.New("no ddb tags"),
+		},
+		{
+			name: "Query on a global index key should query the index",
+			run: func(sess *session.Session) ([]string, error) {
+				var tasks []testTaggedTask
+				_, err := NewWorker(sess, testTaskTable).Key("Group", "a").Reverse(true).Query(&tasks)
+				return taggedIDs(tasks), err
+			},
+			want: []string{"2", "1"},
+		},
+		{
+			name: "Query on a global index key should leave the Worker without an index",
+			run: func(sess *session.Session) ([]string, error) {
+				w := NewWorker(sess, testTaskTable).Key("Group", "a")
+				var tasks []testTaggedTask
+				_, err := w.Query(&tasks)
+				return append(taggedIDs(tasks), "index="+w.IndexName), err
+			},
+			want: []string{"1", "2", "index="},
+		},
+		{
+			name: "QueryAll on a global index key should query the index",
+			run: func(sess *session.Session) ([]string, error) {
+				var tasks []testTaggedTask
+				_, err := NewWorker(sess, testTaskTable).Key("Group", "a").SortKeyGreaterThan("Rank", 1).Limit(1).QueryAll(&tasks)
+				return taggedIDs(tasks), err
+			},
+			want: []string{"2"},
+		},
+		{
+			name: "Query on the table key should query the table",
+			run: func(sess *session.Session) ([]string, error) {
+				var tasks []testTaggedTask
+				_, err := NewWorker(sess, testTaskTable).Key("ID", "3").Query(&tasks)
+				return taggedIDs(tasks), err
+			},
+			want: []string{"3"},
+		},
+		{
+			name: "Query on a local index key should query the index",
+			run: func(sess *session.Session) ([]string, error) {
+				var ranks []testTaggedRank
+				_, err := NewWorker(sess, rankNameTable).Key("Group", "g").SortKeyBeginsWith("TaskName", "b").Query(&ranks)
+				names := make([]string, len(ranks))
+				for i, r := range ranks {
+					names[i] = r.TaskName
+				}
+				return names, err
+			},
+			want: []string{"ba", "bb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sess := setupMemoryDB(t)
+			err := db.CreateTable(ddbmodeltest.TableDef{
+				Name:     rankNameTable,
+				HashKey:  ddbmodeltest.KeyDef{Name: "Group", Type: "S"},
+				RangeKey: ddbmodeltest.KeyDef{Name: "Rank", Type: "N"},
+				Indexes: []ddbmodeltest.IndexDef{
+					{
+						Name:     "Group-TaskName-index",
+						Local:    true,
+						HashKey:  ddbmodeltest.KeyDef{Name: "Group", Type: "S"},
+						RangeKey: ddbmodeltest.KeyDef{Name: "TaskName", Type: "S"},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			seedTasks(t, sess,
+				testTask{ID: "1", Group: "a", Rank: 1, TaskName: "first"},
+				testTask{ID: "2", Group: "a", Rank: 2, TaskName: "second"},
+				testTask{ID: "3", Group: "b", Rank: 1, TaskName: "third"},
+			)
+			for i, name := range []string{"bb", "ab", "ba"} {
+				if err := NewWorker(sess, rankNameTable).Save(testTaggedRank{Group: "g", Rank: i, TaskName: name}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := tt.run(sess)
+			if tt.wantErr != nil {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr.Error()) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func taggedIDs(tasks []testTaggedTask) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func TestWorker_Query(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess,
+		testTask{ID: "1", Group: "a", Rank: 3},
+		testTask{ID: "2", Group: "a", Rank: 1, TaskName: "x"},
+		testTask{ID: "3", Group: "a", Rank: 2, TaskName: "x"},
+		testTask{ID: "4", Group: "b", Rank: 1},
+	)
+
+	tests := []struct {
+		name    string
+		worker  *Worker
+		wantIDs []string
+	}{
+		{
+			name:    "query an index by partition key should return items in sort key order",
+			worker:  NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a"),
+			wantIDs: []string{"2", "3", "1"},
+		},
+		{
+			name:    "reverse query should return items in descending sort key order",
+			worker:  NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a").Reverse(true),
+			wantIDs: []string{"1", "3", "2"},
+		},
+		{
+			name:    "filtered query should only return matching items",
+			worker:  NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a").Filter("TaskName", "x"),
+			wantIDs: []string{"2", "3"},
+		},
+		{
+			name:    "query by table key should return the item",
+			worker:  NewWorker(sess, testTaskTable).Key("ID", "4"),
+			wantIDs: []string{"4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []testTask
+			if _, err := tt.worker.Query(&got); err != nil {
+				t.Fatal(err)
+			}
+			if ids := taskIDs(got); !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Worker.Query() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestWorker_SortKey(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	err := db.CreateTable(ddbmodeltest.TableDef{
+		Name:     "TaskName",
+		HashKey:  ddbmodeltest.KeyDef{Name: "Group", Type: "S"},
+		RangeKey: ddbmodeltest.KeyDef{Name: "TaskName", Type: "S"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"alpha", "alpine", "beta", "alp"} {
+		task := testTask{ID: fmt.Sprint(i + 1), Group: "a", TaskName: name}
+		if err := NewWorker(sess, "TaskName").Save(&task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 6; i++ {
+		seedTasks(t, sess, testTask{ID: fmt.Sprint(i), Group: "a", Rank: i})
+	}
+	seedTasks(t, sess, testTask{ID: "7", Group: "b", Rank: 3})
+
+	ranked := func() *Worker {
+		return NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a")
+	}
+
+	tests := []struct {
+		name    string
+		worker  *Worker
+		wantIDs []string
+	}{
+		{
+			name:    "begins_with should match sort keys with the prefix",
+			worker:  NewWorker(sess, "TaskName").Key("Group", "a").SortKeyBeginsWith("TaskName", "alp"),
+			wantIDs: []string{"4", "1", "2"},
+		},
+		{
+			name:    "between should include both bounds",
+			worker:  ranked().SortKeyBetween("Rank", 2, 4),
+			wantIDs: []string{"2", "3", "4"},
+		},
+		{
+			name:    "less than should exclude the value",
+			worker:  ranked().SortKeyLessThan("Rank", 3),
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "less than or equal should include the value",
+			worker:  ranked().SortKeyLessThanEqual("Rank", 3),
+			wantIDs: []string{"1", "2", "3"},
+		},
+		{
+			name:    "greater than should exclude the value",
+			worker:  ranked().SortKeyGreaterThan("Rank", 4),
+			wantIDs: []string{"5", "6"},
+		},
+		{
+			name:    "greater than or equal should include the value",
+			worker:  ranked().SortKeyGreaterThanEqual("Rank", 4),
+			wantIDs: []string{"4", "5", "6"},
+		},
+		{
+			name:    "a later condition should replace an earlier one",
+			worker:  ranked().SortKeyLessThan("Rank", 2).SortKeyGreaterThan("Rank", 5),
+			wantIDs: []string{"6"},
+		},
+		{
+			name:    "reverse should return matches in descending order",
+			worker:  ranked().SortKeyGreaterThan("Rank", 3).Reverse(true),
+			wantIDs: []string{"6", "5", "4"},
+		},
+		{
+			name:    "limit should page through the matches",
+			worker:  ranked().SortKeyGreaterThan("Rank", 1).Limit(2),
+			wantIDs: []string{"2", "3"},
+		},
+		{
+			name:    "offset should resume after the previous page",
+			worker:  ranked().SortKeyGreaterThan("Rank", 1).Limit(2).Offset(mustQuery(t, ranked().SortKeyGreaterThan("Rank", 1).Limit(2))),
+			wantIDs: []string{"4", "5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []testTask
+			if _, err := tt.worker.Query(&got); err != nil {
+				t.Fatal(err)
+			}
+			if ids := taskIDs(got); !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Worker.Query() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func mustQuery(t *testing.T, w *Worker) string {
+	var discard []testTask
+	offset, err := w.Query(&discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offset
+}
+
+func TestWorker_QueryOffset(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess,
+		testTask{ID: "1", Group: "a", Rank: 1},
+		testTask{ID: "2", Group: "a", Rank: 2},
+		testTask{ID: "3", Group: "a", Rank: 3},
+	)
+
+	w := NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a").Limit(2)
+
+	var page1 []testTask
+	offset, err := w.Query(&page1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset == "" || !reflect.DeepEqual(taskIDs(page1), []string{"1", "2"}) {
+		t.Fatalf("first page = %v, offset %q", taskIDs(page1), offset)
+	}
+
+	var page2 []testTask
+	if _, err := w.Query(&page2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(taskIDs(page2), []string{"3"}) {
+		t.Errorf("second page = %v, want [3]", taskIDs(page2))
+	}
+}
+
+func TestWorker_QueryAll(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	var tasks []testTask
+	for i := 1; i <= 10; i++ {
+		task := testTask{ID: fmt.Sprint(i), Group: "a", Rank: i}
+		if i%4 == 0 {
+			task.TaskName = "x"
+		}
+		tasks = append(tasks, task)
+	}
+	seedTasks(t, sess, tasks...)
+
+	query := func() *Worker {
+		return NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a").Limit(3)
+	}
+
+	tests := []struct {
+		name       string
+		worker     *Worker
+		dst        []testTask
+		wantIDs    []string
+		wantOffset bool
+	}{
+		{
+			name:    "every page should be read",
+			worker:  query(),
+			wantIDs: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
+		},
+		{
+			name:       "reading should stop at MaxItems",
+			worker:     query().MaxItems(4),
+			wantIDs:    []string{"1", "2", "3", "4"},
+			wantOffset: true,
+		},
+		{
+			name:       "reading should stop at MaxPages",
+			worker:     query().MaxPages(2),
+			wantIDs:    []string{"1", "2", "3", "4", "5", "6"},
+			wantOffset: true,
+		},
+		{
+			name:    "pages emptied by a filter should be followed",
+			worker:  query().Filter("TaskName", "x"),
+			wantIDs: []string{"4", "8"},
+		},
+		{
+			name:    "items should be appended to the destination",
+			worker:  query().Offset(mustQueryOffset(t, query().MaxItems(8))),
+			dst:     []testTask{{ID: "kept"}},
+			wantIDs: []string{"kept", "9", "10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.dst
+			offset, err := tt.worker.QueryAll(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := taskIDs(got); !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Worker.QueryAll() = %v, want %v", ids, tt.wantIDs)
+			}
+			if (offset != "") != tt.wantOffset {
+				t.Errorf("Worker.QueryAll() offset = %q, wantOffset %v", offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func mustQueryOffset(t *testing.T, w *Worker) string {
+	var discard []testTask
+	offset, err := w.QueryAll(&discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offset
+}
+
+func TestIterator_Offset(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	var tasks []testTask
+	for i := 1; i <= 10; i++ {
+		task := testTask{ID: fmt.Sprint(i), Group: "a", Rank: i}
+		if i%4 == 0 {
+			task.TaskName = "x"
+		}
+		tasks = append(tasks, task)
+	}
+	seedTasks(t, sess, tasks...)
+
+	query := func(limit int64) *Worker {
+		return NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a").Limit(limit)
+	}
+	all := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+
+	tests := []struct {
+		name      string
+		worker    func() *Worker
+		iterator  func(*Worker) *Iterator
+		stopAfter int
+		// tagged decodes the items into a type with ddb tags.
+		tagged  bool
+		wantIDs []string
+	}{
+		{
+			name:      "resuming within a page should continue after the last item",
+			worker:    func() *Worker { return query(3) },
+			iterator:  (*Worker).QueryIterator,
+			stopAfter: 4,
+			wantIDs:   all,
+		},
+		{
+			name:      "resuming at a page boundary should continue with the next page",
+			worker:    func() *Worker { return query(3) },
+			iterator:  (*Worker).QueryIterator,
+			stopAfter: 6,
+			wantIDs:   all,
+		},
+		{
+			name:      "resuming within a single page should continue after the last item",
+			worker:    func() *Worker { return query(0) },
+			iterator:  (*Worker).QueryIterator,
+			stopAfter: 7,
+			tagged:    true,
+			wantIDs:   all,
+		},
+		{
+			name:      "resuming within a single page of items without ddb tags should start the page over",
+			worker:    func() *Worker { return query(0) },
+			iterator:  (*Worker).QueryIterator,
+			stopAfter: 2,
+			wantIDs:   []string{"1", "1", "2", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
+		},
+		{
+			name:      "resuming a filtered query should skip pages without matches",
+			worker:    func() *Worker { return query(3).Filter("TaskName", "x") },
+			iterator:  (*Worker).QueryIterator,
+			stopAfter: 1,
+			wantIDs:   []string{"4", "8"},
+		},
+		{
+			name:      "resuming before the first item should start over",
+			worker:    func() *Worker { return query(3) },
+			iterator:  (*Worker).QueryIterator,
+			stopAfter: 0,
+			wantIDs:   all,
+		},
+		{
+			name:      "resuming a scan should continue after the last item",
+			worker:    func() *Worker { return NewWorker(sess, testTaskTable).Limit(4) },
+			iterator:  (*Worker).ScanIterator,
+			stopAfter: 5,
+			wantIDs:   all,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := func(it *Iterator) (string, bool) {
+				if tt.tagged {
+					var task testTaggedTask
+					ok := it.Next(&task)
+					return task.ID, ok
+				}
+				var task testTask
+				ok := it.Next(&task)
+				return task.ID, ok
+			}
+
+			var ids []string
+			it := tt.iterator(tt.worker())
+			for len(ids) < tt.stopAfter {
+				id, ok := next(it)
+				if !ok {
+					break
+				}
+				ids = append(ids, id)
+			}
+			offset := it.Offset()
+
+			it = tt.iterator(tt.worker().Offset(offset))
+			for {
+				id, ok := next(it)
+				if !ok {
+					break
+				}
+				ids = append(ids, id)
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if offset := it.Offset(); offset != "" {
+				t.Errorf("Iterator.Offset() after the last item = %q, want empty", offset)
+			}
+
+			sort.Slice(ids, func(i, j int) bool { return len(ids[i]) < len(ids[j]) || len(ids[i]) == len(ids[j]) && ids[i] < ids[j] })
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Iterator.Next() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestIterator_Err(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess, testTask{ID: "1"}, testTask{ID: "2"}, testTask{ID: "3"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it := NewWorker(sess, testTaskTable).Context(ctx).Limit(2).ScanIterator()
+	var task testTask
+	if !it.Next(&task) {
+		t.Fatalf("Iterator.Next() = false, error = %v", it.Err())
+	}
+	cancel()
+	for it.Next(&task) {
+	}
+	if err := it.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Iterator.Err() with a canceled context = %v, want context.Canceled", err)
+	}
+
+	it = NewWorker(sess, testTaskTable).Key("ID", "1").QueryIterator()
+	var wrong []string
+	if it.Next(&wrong) || it.Err() == nil {
+		t.Errorf("Iterator.Next() into a slice error = %v, want an error", it.Err())
+	}
+}
+
+func TestWorker_ScanAll(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	var items []interface{}
+	for _, id := range batchIDs(7) {
+		items = append(items, testTask{ID: id})
+	}
+	if err := NewWorker(sess, testTaskTable).BatchSave(items); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []testTask
+	offset, err := NewWorker(sess, testTaskTable).Limit(2).ScanAll(&got)
+	if err != nil || offset != "" {
+		t.Fatalf("Worker.ScanAll() offset = %q, error = %v", offset, err)
+	}
+	ids := taskIDs(got)
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, batchIDs(7)) {
+		t.Errorf("Worker.ScanAll() = %v, want %v", ids, batchIDs(7))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewWorker(sess, testTaskTable).Context(ctx).Limit(2).ScanAll(&got); !errors.Is(err, context.Canceled) {
+		t.Errorf("Worker.ScanAll() with a canceled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWorker_ParallelScan(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	var items []interface{}
+	for _, id := range batchIDs(60) {
+		items = append(items, testTask{ID: id})
+	}
+	if err := NewWorker(sess, testTaskTable).BatchSave(items); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]int{}
+	)
+	collect := func(stopSegment int) func(int, *Iterator) error {
+		return func(segment int, it *Iterator) error {
+			var task testTask
+			for it.Next(&task) {
+				mu.Lock()
+				seen[task.ID]++
+				mu.Unlock()
+				if segment == stopSegment {
+					return errStop
+				}
+			}
+			return it.Err()
+		}
+	}
+
+	cursors, err := NewWorker(sess, testTaskTable).Limit(2).ParallelScan(4, collect(1))
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Worker.ParallelScan() error = %v, want errStop", err)
+	}
+	if len(cursors) != 4 || cursors[1].Done || cursors[1].Offset == "" {
+		t.Fatalf("Worker.ParallelScan() cursors = %+v, want segment 1 resumable", cursors)
+	}
+
+	cursors, err = NewWorker(sess, testTaskTable).Limit(2).ResumeSegments(cursors).ParallelScan(4, collect(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range cursors {
+		if !c.Done || c.Offset != "" {
+			t.Errorf("Worker.ParallelScan() cursor %d = %+v, want done", i, c)
+		}
+	}
+	for _, id := range batchIDs(60) {
+		if seen[id] != 1 {
+			t.Errorf("item %s was read %d times, want once", id, seen[id])
+		}
+	}
+
+	if _, err := NewWorker(sess, testTaskTable).ResumeSegments(cursors).ParallelScan(2, collect(-1)); err == nil {
+		t.Error("Worker.ParallelScan() with cursors of another segment count error = nil, want an error")
+	}
+}
+
+var errStop = errors.New("stop")
+
+func TestWorker_Scan(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess,
+		testTask{ID: "1", TaskName: "x"},
+		testTask{ID: "2", TaskName: "y"},
+		testTask{ID: "3", TaskName: "x"},
+	)
+
+	tests := []struct {
+		name    string
+		worker  *Worker
+		wantIDs []string
+	}{
+		{
+			name:    "scan should return every item",
+			worker:  NewWorker(sess, testTaskTable),
+			wantIDs: []string{"1", "2", "3"},
+		},
+		{
+			name:    "filtered scan should only return matching items",
+			worker:  NewWorker(sess, testTaskTable).Filter("TaskName", "x"),
+			wantIDs: []string{"1", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []testTask
+			if _, err := tt.worker.Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			ids := taskIDs(got)
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Worker.Scan() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestWorker_FilterCondition(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess,
+		testTask{ID: "1", Group: "a", Rank: 1, Amount: 1, TaskName: "build", Tags: []string{"ci"}},
+		testTask{ID: "2", Group: "a", Rank: 2, Amount: 2, TaskName: "deploy", Tags: []string{"ci", "prod"}},
+		testTask{ID: "3", Group: "a", Rank: 3, Amount: 3, TaskName: "bench"},
+		testTask{ID: "4", Group: "a", Rank: 4, Amount: 4},
+		testTask{ID: "5", Group: "b", Rank: 5, Amount: 5, TaskName: "build"},
+	)
+
+	name := expression.Name
+	value := expression.Value
+	tests := []struct {
+		name    string
+		cond    expression.ConditionBuilder
+		filter  map[string]interface{}
+		wantIDs []string
+	}{
+		{
+			name:    "not equal should exclude the value",
+			cond:    name("TaskName").NotEqual(value("build")),
+			wantIDs: []string{"2", "3", "4"},
+		},
+		{
+			name:    "less than should compare numbers",
+			cond:    name("Amount").LessThan(value(3)),
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "greater than should compare numbers",
+			cond:    name("Amount").GreaterThan(value(3)),
+			wantIDs: []string{"4", "5"},
+		},
+		{
+			name:    "between should include both bounds",
+			cond:    name("Amount").Between(value(2), value(4)),
+			wantIDs: []string{"2", "3", "4"},
+		},
+		{
+			name:    "in should match any listed value",
+			cond:    name("TaskName").In(value("bench"), value("deploy")),
+			wantIDs: []string{"2", "3"},
+		},
+		{
+			name:    "begins_with should match the prefix",
+			cond:    name("TaskName").BeginsWith("b"),
+			wantIDs: []string{"1", "3", "5"},
+		},
+		{
+			name:    "contains should look into sets",
+			cond:    name("Tags").Contains("prod"),
+			wantIDs: []string{"2"},
+		},
+		{
+			name:    "attribute_exists should match present attributes",
+			cond:    name("Tags").AttributeExists(),
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "attribute_not_exists should match missing attributes",
+			cond:    name("TaskName").AttributeNotExists(),
+			wantIDs: []string{"4"},
+		},
+		{
+			name:    "attribute_type should match the type",
+			cond:    name("Tags").AttributeType(expression.StringSet),
+			wantIDs: []string{"1", "2"},
+		},
+		{
+			name:    "size should compare the attribute length",
+			cond:    name("TaskName").Size().GreaterThan(value(5)),
+			wantIDs: []string{"2"},
+		},
+		{
+			name:    "or should match either side",
+			cond:    name("Amount").Equal(value(1)).Or(name("TaskName").Equal(value("bench"))),
+			wantIDs: []string{"1", "3"},
+		},
+		{
+			name:    "not should invert the condition",
+			cond:    expression.Not(name("TaskName").BeginsWith("b")),
+			wantIDs: []string{"2", "4"},
+		},
+		{
+			name:    "conditions should combine with equality filters",
+			cond:    name("Amount").GreaterThan(value(1)),
+			filter:  map[string]interface{}{"TaskName": "build"},
+			wantIDs: []string{"5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan := NewWorker(sess, testTaskTable).FilterCondition(tt.cond)
+			for k, v := range tt.filter {
+				scan.Filter(k, v)
+			}
+			var got []testTask
+			if _, err := scan.Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			ids := taskIDs(got)
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Worker.Scan() = %v, want %v", ids, tt.wantIDs)
+			}
+
+			query := NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).Key("Group", "a").FilterCondition(tt.cond)
+			for k, v := range tt.filter {
+				query.Filter(k, v)
+			}
+			got = nil
+			if _, err := query.Query(&got); err != nil {
+				t.Fatal(err)
+			}
+			// Item 5 is outside the queried group.
+			wantIDs := []string{}
+			for _, id := range tt.wantIDs {
+				if id != "5" {
+					wantIDs = append(wantIDs, id)
+				}
+			}
+			if ids := taskIDs(got); !reflect.DeepEqual(ids, wantIDs) {
+				t.Errorf("Worker.Query() = %v, want %v", ids, wantIDs)
+			}
+		})
+	}
+}
+
+func TestWorker_ScanByExpression(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	for i := 1; i <= 6; i++ {
+		seedTasks(t, sess, testTask{ID: fmt.Sprint(i), Group: "a", Rank: i, Amount: int64(i)})
+	}
+
+	build := func(t *testing.T, builder expression.Builder) expression.Expression {
+		expr, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return expr
+	}
+	amountOver := func(t *testing.T, n int) expression.Expression {
+		return build(t, expression.NewBuilder().WithFilter(expression.Name("Amount").GreaterThan(expression.Value(n))))
+	}
+
+	tests := []struct {
+		name      string
+		worker    *Worker
+		expr      func(t *testing.T) expression.Expression
+		wantIDs   []string
+		wantCount int64
+		wantErr   bool
+	}{
+		{
+			name:      "filter should only return matching items",
+			worker:    NewWorker(sess, testTaskTable),
+			expr:      func(t *testing.T) expression.Expression { return amountOver(t, 4) },
+			wantIDs:   []string{"5", "6"},
+			wantCount: 2,
+		},
+		{
+			name:   "projection should only return the projected attributes",
+			worker: NewWorker(sess, testTaskTable),
+			expr: func(t *testing.T) expression.Expression {
+				return build(t, expression.NewBuilder().
+					WithFilter(expression.Name("Amount").Equal(expression.Value(3))).
+					WithProjection(expression.NamesList(expression.Name("ID"))))
+			},
+			wantIDs:   []string{"3"},
+			wantCount: 1,
+		},
+		{
+			name:      "index should scan the index",
+			worker:    NewWorker(sess, testTaskTable).Index(testTaskGroupIndex),
+			expr:      func(t *testing.T) expression.Expression { return amountOver(t, 3) },
+			wantIDs:   []string{"4", "5", "6"},
+			wantCount: 3,
+		},
+		{
+			name:      "select count should only count the items",
+			worker:    NewWorker(sess, testTaskTable).Select(dynamodb.SelectCount),
+			expr:      func(t *testing.T) expression.Expression { return amountOver(t, 2) },
+			wantIDs:   []string{},
+			wantCount: 4,
+		},
+		{
+			name:      "consistent read should be allowed on the table",
+			worker:    NewWorker(sess, testTaskTable).ConsistentRead(true),
+			expr:      func(t *testing.T) expression.Expression { return amountOver(t, 5) },
+			wantIDs:   []string{"6"},
+			wantCount: 1,
+		},
+		{
+			name:    "consistent read should be rejected on a global index",
+			worker:  NewWorker(sess, testTaskTable).Index(testTaskGroupIndex).ConsistentRead(true),
+			expr:    func(t *testing.T) expression.Expression { return amountOver(t, 5) },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []testTask
+			_, err := tt.worker.ScanByExpression(tt.expr(t), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Worker.ScanByExpression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			ids := taskIDs(got)
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Worker.ScanByExpression() = %v, want %v", ids, tt.wantIDs)
+			}
+			if tt.worker.ResultCount != tt.wantCount {
+				t.Errorf("Worker.ResultCount = %d, want %d", tt.worker.ResultCount, tt.wantCount)
+			}
+		})
+	}
+
+	t.Run("limit and offset should page through every item", func(t *testing.T) {
+		var ids []string
+		w := NewWorker(sess, testTaskTable).Limit(2)
+		for pages := 1; ; pages++ {
+			var got []testTask
+			offset, err := w.ScanByExpression(amountOver(t, 1), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, taskIDs(got)...)
+			if offset == "" {
+				break
+			}
+			if pages > 6 {
+				t.Fatal("Worker.ScanByExpression() did not reach the last page")
+			}
+		}
+		sort.Strings(ids)
+		if want := []string{"2", "3", "4", "5", "6"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("Worker.ScanByExpression() pages = %v, want %v", ids, want)
+		}
+	})
+}
+
+func TestWorker_Updates(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess, testTask{ID: "1", TaskName: "old", Amount: 1, Tags: []string{"a"}})
+
+	w := NewWorker(sess, testTaskTable).Key("ID", "1")
+	if err := w.Incr("Amount", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add2Set("Tags", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Update("TaskName", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.BatchUpdate(map[string]interface{}{"Group": "g", "Rank": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got testTask
+	if err := NewWorker(sess, testTaskTable).Key("ID", "1").Get(&got); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got.Tags)
+	want := testTask{ID: "1", Group: "g", Rank: 7, TaskName: "new", Amount: 3, Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after updates got %+v, want %+v", got, want)
+	}
+
+	if err := w.RemoveAttribute("TaskName"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWorker(sess, testTaskTable).Key("ID", "1").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWorker(sess, testTaskTable).Key("ID", "1").Get(&got); err == nil {
+		t.Error("Worker.Get() after Delete() should fail")
+	}
+}
+
+func TestWorker_When(t *testing.T) {
+	name := expression.Name
+	value := expression.Value
+	stockAtLeast := func(n int) expression.ConditionBuilder {
+		return name("Amount").GreaterThanEqual(value(n))
+	}
+	draft := name("TaskName").Equal(value("draft"))
+	seeded := testTask{ID: "1", TaskName: "draft", Amount: 10}
+
+	tests := []struct {
+		name       string
+		write      func(w *Worker) error
+		wantFailed bool
+		want       testTask
+	}{
+		{
+			name:  "incr should apply when the condition holds",
+			write: func(w *Worker) error { return w.When(stockAtLeast(3)).Incr("Amount", -3) },
+			want:  testTask{ID: "1", TaskName: "draft", Amount: 7},
+		},
+		{
+			name:       "incr should fail when the condition does not hold",
+			write:      func(w *Worker) error { return w.When(stockAtLeast(20)).Incr("Amount", -20) },
+			wantFailed: true,
+			want:       seeded,
+		},
+		{
+			name:  "update should apply when the condition holds",
+			write: func(w *Worker) error { return w.When(draft).Update("TaskName", "done") },
+			want:  testTask{ID: "1", TaskName: "done", Amount: 10},
+		},
+		{
+			name:       "remove attribute should fail when the condition does not hold",
+			write:      func(w *Worker) error { return w.When(name("Tags").AttributeExists()).RemoveAttribute("TaskName") },
+			wantFailed: true,
+			want:       seeded,
+		},
+		{
+			name: "batch update should apply when every condition holds",
+			write: func(w *Worker) error {
+				return w.When(draft).When(stockAtLeast(10)).BatchUpdate(map[string]interface{}{"TaskName": "done"})
+			},
+			want: testTask{ID: "1", TaskName: "done", Amount: 10},
+		},
+		{
+			name: "batch update should fail when any condition does not hold",
+			write: func(w *Worker) error {
+				return w.When(draft).When(stockAtLeast(11)).BatchUpdate(map[string]interface{}{"TaskName": "done"})
+			},
+			wantFailed: true,
+			want:       seeded,
+		},
+		{
+			name:  "delete should apply when the condition holds",
+			write: func(w *Worker) error { return w.When(draft).Delete() },
+		},
+		{
+			name:       "delete should fail when the condition does not hold",
+			write:      func(w *Worker) error { return w.When(name("TaskName").Equal(value("done"))).Delete() },
+			wantFailed: true,
+			want:       seeded,
+		},
+		{
+			name: "update by expression should combine its condition with When",
+			write: func(w *Worker) error {
+				expr, err := expression.NewBuilder().
+					WithUpdate(expression.Set(name("TaskName"), value("done"))).
+					WithCondition(stockAtLeast(5)).
+					Build()
+				if err != nil {
+					return err
+				}
+				return w.When(draft).UpdateByExpression(expr)
+			},
+			want: testTask{ID: "1", TaskName: "done", Amount: 10},
+		},
+		{
+			name: "update by expression should fail when its condition does not hold",
+			write: func(w *Worker) error {
+				expr, err := expression.NewBuilder().
+					WithUpdate(expression.Set(name("TaskName"), value("done"))).
+					WithCondition(stockAtLeast(50)).
+					Build()
+				if err != nil {
+					return err
+				}
+				return w.When(draft).UpdateByExpression(expr)
+			},
+			wantFailed: true,
+			want:       seeded,
+		},
+		{
+			name: "an expression reused after a conditional update should not keep the condition",
+			write: func(w *Worker) error {
+				expr, err := expression.NewBuilder().
+					WithUpdate(expression.Add(name("Amount"), value(1))).
+					Build()
+				if err != nil {
+					return err
+				}
+				if err := w.When(draft).UpdateByExpression(expr); err != nil {
+					return err
+				}
+				return NewWorker(w.AwsSession, testTaskTable).Key("ID", "1").UpdateByExpression(expr)
+			},
+			want: testTask{ID: "1", TaskName: "draft", Amount: 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			seedTasks(t, sess, seeded)
+
+			err := tt.write(NewWorker(sess, testTaskTable).Key("ID", "1"))
+			var condErr *ConditionFailedError
+			if errors.As(err, &condErr) != tt.wantFailed || !tt.wantFailed && err != nil {
+				t.Fatalf("write error = %v, wantFailed %v", err, tt.wantFailed)
+			}
+
+			var got testTask
+			err = NewWorker(sess, testTaskTable).Key("ID", "1").Get(&got)
+			if _, empty := err.(*DdbModelEmptyError); err != nil && !empty {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stored item = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorker_ReturnValues(t *testing.T) {
+	seeded := testTask{ID: "1", TaskName: "old", Amount: 10}
+
+	tests := []struct {
+		name  string
+		write func(w *Worker, dst *testTask) error
+		want  testTask
+	}{
+		{
+			name: "all new should return the whole updated item",
+			write: func(w *Worker, dst *testTask) error {
+				return w.ReturnValues(dynamodb.ReturnValueAllNew, dst).Update("TaskName", "new")
+			},
+			want: testTask{ID: "1", TaskName: "new", Amount: 10},
+		},
+		{
+			name: "updated new should return the updated attributes",
+			write: func(w *Worker, dst *testTask) error {
+				return w.ReturnValues(dynamodb.ReturnValueUpdatedNew, dst).Incr("Amount", 5)
+			},
+			want: testTask{Amount: 15},
+		},
+		{
+			name: "all old should return the whole item before the update",
+			write: func(w *Worker, dst *testTask) error {
+				return w.ReturnValues(dynamodb.ReturnValueAllOld, dst).Update("TaskName", "new")
+			},
+			want: seeded,
+		},
+		{
+			name: "updated old should return the updated attributes before the update",
+			write: func(w *Worker, dst *testTask) error {
+				return w.ReturnValues(dynamodb.ReturnValueUpdatedOld, dst).Update("TaskName", "new")
+			},
+			want: testTask{TaskName: "old"},
+		},
+		{
+			name:  "delete should return the deleted item",
+			write: func(w *Worker, dst *testTask) error { return w.ReturnValues(dynamodb.ReturnValueAllOld, dst).Delete() },
+			want:  seeded,
+		},
+		{
+			name:  "delete and return should return the deleted item",
+			write: func(w *Worker, dst *testTask) error { return w.DeleteAndReturn(dst) },
+			want:  seeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			seedTasks(t, sess, seeded)
+
+			var got testTask
+			if err := tt.write(NewWorker(sess, testTaskTable).Key("ID", "1"), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("returned item = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("incr and get should return the incremented value", func(t *testing.T) {
+		_, sess := setupMemoryDB(t)
+		seedTasks(t, sess, seeded)
+
+		for _, want := range []int64{13, 16} {
+			got, err := NewWorker(sess, testTaskTable).Key("ID", "1").IncrAndGet("Amount", 3)
+			if err != nil || got != want {
+				t.Errorf("Worker.IncrAndGet() = %d, %v, want %d", got, err, want)
+			}
+		}
+	})
+
+	t.Run("delete and return should report a missing item", func(t *testing.T) {
+		_, sess := setupMemoryDB(t)
+
+		var got testTask
+		err := NewWorker(sess, testTaskTable).Key("ID", "1").DeleteAndReturn(&got)
+		if _, ok := err.(*DdbModelEmptyError); !ok {
+			t.Errorf("Worker.DeleteAndReturn() error = %v, want DdbModelEmptyError", err)
+		}
+	})
+}
+
+func TestWorker_BatchSave(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		items      []interface{}
+		wantFailed []int
+		wantIDs    []string
+	}{
+		{
+			name:    "items beyond one request and left unprocessed should all be saved",
+			ctx:     context.Background(),
+			items:   batchTasks(60),
+			wantIDs: batchIDs(60),
+		},
+		{
+			name: "items that cannot be marshaled or are too large should be reported",
+			ctx:  context.Background(),
+			items: []interface{}{
+				testTask{ID: "0"},
+				map[string]interface{}{"ID": "1", "Bad": badAttribute{}},
+				testTask{ID: "2", TaskName: strings.Repeat("x", 400<<10)},
+				testTask{ID: "3"},
+			},
+			wantFailed: []int{1, 2},
+			wantIDs:    []string{"0", "3"},
+		},
+		{
+			name:       "a canceled context should fail every item",
+			ctx:        canceled,
+			items:      batchTasks(3),
+			wantFailed: []int{0, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sess := setupMemoryDB(t)
+			db.MaxBatchWrites = 7
+
+			w := NewWorker(sess, testTaskTable).Context(tt.ctx).Backoff(Backoff{Base: time.Millisecond, Max: time.Millisecond})
+			err := w.BatchSave(tt.items)
+
+			var failed []int
+			var batchErr *BatchWriteError
+			if errors.As(err, &batchErr) {
+				for _, f := range batchErr.Failed {
+					failed = append(failed, f.Index)
+				}
+			} else if err != nil {
+				t.Fatalf("Worker.BatchSave() error = %v, want *BatchWriteError", err)
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("Worker.BatchSave() failed items = %v, want %v", failed, tt.wantFailed)
+			}
+			if tt.ctx == canceled && !errors.Is(err, context.Canceled) {
+				t.Errorf("Worker.BatchSave() error = %v, want context.Canceled", err)
+			}
+
+			var got []testTask
+			if _, err := NewWorker(sess, testTaskTable).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			ids := taskIDs(got)
+			sort.Strings(ids)
+			want := append([]string(nil), tt.wantIDs...)
+			sort.Strings(want)
+			if len(ids) != len(want) || len(want) > 0 && !reflect.DeepEqual(ids, want) {
+				t.Errorf("saved items = %v, want %v", ids, want)
+			}
+		})
+	}
+}
+
+func TestWorker_BatchSave_RepeatedKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []interface{}
+	}{
+		{
+			name: "a key repeated in items of a described table should keep the last write",
+			items: []interface{}{
+				testTask{ID: "1", TaskName: "first"},
+				testTask{ID: "2", TaskName: "other"},
+				testTask{ID: "1", TaskName: "last"},
+			},
+		},
+		{
+			name: "a key repeated in items with ddb tags should keep the last write",
+			items: []interface{}{
+				testTaggedTask{ID: "1", TaskName: "first"},
+				testTaggedTask{ID: "2", TaskName: "other"},
+				testTaggedTask{ID: "1", TaskName: "last"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+
+			if err := NewWorker(sess, testTaskTable).BatchSave(tt.items); err != nil {
+				t.Fatalf("Worker.BatchSave() error = %v", err)
+			}
+
+			var got []testTask
+			if _, err := NewWorker(sess, testTaskTable).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			names := map[string]string{}
+			for _, task := range got {
+				names[task.ID] = task.TaskName
+			}
+			if want := map[string]string{"1": "last", "2": "other"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("saved task names = %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestWorker_BatchSave_KeyNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		table      string
+		wantFailed []int
+		wantCached []string
+	}{
+		{
+			name:       "items of a described table should be saved and its key names cached",
+			table:      testTaskTable,
+			wantCached: []string{"ID"},
+		},
+		{
+			name:       "items of a table that does not exist should all fail",
+			table:      "Missing",
+			wantFailed: []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			tableKeyNames.Delete(tt.table)
+			defer tableKeyNames.Delete(tt.table)
+
+			err := NewWorker(sess, tt.table).BatchSave(batchTasks(2))
+
+			var failed []int
+			var batchErr *BatchWriteError
+			if errors.As(err, &batchErr) {
+				for _, f := range batchErr.Failed {
+					failed = append(failed, f.Index)
+				}
+			} else if err != nil {
+				t.Fatalf("Worker.BatchSave() error = %v, want *BatchWriteError", err)
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("Worker.BatchSave() failed items = %v, want %v", failed, tt.wantFailed)
+			}
+
+			var cached []string
+			if v, ok := tableKeyNames.Load(tt.table); ok {
+				cached = v.([]string)
+			}
+			if !reflect.DeepEqual(cached, tt.wantCached) {
+				t.Errorf("cached key names = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestUnprocessedRequests(t *testing.T) {
+	put := func(id string) *dynamodb.WriteRequest {
+		return &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: map[string]*dynamodb.AttributeValue{
+			"ID":       {S: aws.String(id)},
+			"TaskName": {S: aws.String("task " + id)},
+		}}}
+	}
+	keyNames := map[string][]string{testTaskTable: {"ID"}}
+	var pending []batchRequest
+	for i, id := range []string{"0", "1", "2"} {
+		wr := put(id)
+		pending = append(pending, batchRequest{index: i, table: testTaskTable, request: wr, key: itemKey(testTaskTable, wr.PutRequest.Item, keyNames[testTaskTable])})
+	}
+
+	tests := []struct {
+		name        string
+		unprocessed []*dynamodb.WriteRequest
+		want        []int
+		wantErr     bool
+	}{
+		{
+			name:        "requests handed back should be matched by key",
+			unprocessed: []*dynamodb.WriteRequest{put("2"), {PutRequest: &dynamodb.PutRequest{Item: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("0")}}}}},
+			want:        []int{0, 2},
+		},
+		{
+			name:        "a request handed back that matches none sent should be an error",
+			unprocessed: []*dynamodb.WriteRequest{put("1"), put("9")},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, err := unprocessedRequests(pending, map[string][]*dynamodb.WriteRequest{testTaskTable: tt.unprocessed}, keyNames)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unprocessedRequests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []int
+			for _, r := range rest {
+				got = append(got, r.index)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unprocessedRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorker_BatchDelete(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	db.MaxBatchWrites = 7
+
+	w := NewWorker(sess, testTaskTable).Backoff(Backoff{Base: time.Millisecond, Max: time.Millisecond})
+	if err := w.BatchSave(batchTasks(60)); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]map[string]interface{}, 50)
+	for i := range keys {
+		keys[i] = map[string]interface{}{"ID": fmt.Sprint(i)}
+	}
+	if err := w.BatchDelete(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []testTask
+	if _, err := NewWorker(sess, testTaskTable).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	ids := taskIDs(got)
+	sort.Strings(ids)
+	want := batchIDs(60)[50:]
+	sort.Strings(want)
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("items left after Worker.BatchDelete() = %v, want %v", ids, want)
+	}
+}
+
+func TestBatchWriter_Write(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	db.MaxBatchWrites = 2
+	seedTasks(t, sess, testTask{ID: "old"})
+	if err := NewWorker(sess, testRankTable).Save(testTask{Group: "g", Rank: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	bw := NewWorker(sess, testTaskTable).Backoff(Backoff{Base: time.Millisecond, Max: time.Millisecond}).BatchWriter()
+	bw.Put(testTaskTable, testTask{ID: "new"}).
+		Delete(testTaskTable, map[string]interface{}{"ID": "old"}).
+		Put(testTaskTable, map[string]interface{}{"ID": "bad", "Bad": badAttribute{}}).
+		Put(testRankTable, testTask{Group: "g", Rank: 1}).
+		Delete(testRankTable, map[string]interface{}{"Group": "g", "Rank": 2})
+
+	err := bw.Write()
+	var batchErr *BatchWriteError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("BatchWriter.Write() error = %v, want *BatchWriteError", err)
+	}
+	if len(batchErr.Failed) != 1 || batchErr.Failed[0].Index != 2 || batchErr.Failed[0].Table != testTaskTable {
+		t.Errorf("BatchWriter.Write() failed = %+v, want only the item at 2", batchErr.Failed)
+	}
+
+	var tasks, ranked []testTask
+	if _, err := NewWorker(sess, testTaskTable).Scan(&tasks); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWorker(sess, testRankTable).Scan(&ranked); err != nil {
+		t.Fatal(err)
+	}
+	if ids := taskIDs(tasks); !reflect.DeepEqual(ids, []string{"new"}) {
+		t.Errorf("%s after BatchWriter.Write() = %v, want [new]", testTaskTable, ids)
+	}
+	if len(ranked) != 1 || ranked[0].Rank != 1 {
+		t.Errorf("%s after BatchWriter.Write() = %+v, want only rank 1", testRankTable, ranked)
+	}
+}
+
+func TestTransactWriter_Write(t *testing.T) {
+	name := expression.Name
+	value := expression.Value
+	key := func(id string) map[string]interface{} { return map[string]interface{}{"ID": id} }
+	bigTask := func(id string, size int) testTask { return testTask{ID: id, TaskName: strings.Repeat("x", size)} }
+
+	tests := []struct {
+		name      string
+		build     func(tw *TransactWriter)
+		twice     bool
+		wantErr   error
+		wantTasks []testTask
+		wantRanks []int
+	}{
+		{
+			name: "actions of every kind across tables should all be written",
+			build: func(tw *TransactWriter) {
+				tw.Put(testTaskTable, testTask{ID: "new", Amount: 1}, name("ID").AttributeNotExists()).
+					Delete(testTaskTable, key("old"), name("Amount").Equal(value(1))).
+					Update(testTaskTable, key("counter"),
+						expression.Set(name("TaskName"), value("counted")).
+							Add(name("Amount"), value(2)).
+							Remove(name("Group")).
+							Delete(name("Tags"), expression.Value(&dynamodb.AttributeValue{SS: []*string{aws.String("a")}})),
+						name("Amount").GreaterThanEqual(value(5))).
+					ConditionCheck(testRankTable, map[string]interface{}{"Group": "g", "Rank": 2}, name("Rank").AttributeExists()).
+					Put(testRankTable, testTask{Group: "g", Rank: 1})
+			},
+			wantTasks: []testTask{
+				{ID: "counter", TaskName: "counted", Amount: 7, Tags: []string{"b"}},
+				{ID: "new", Amount: 1},
+			},
+			wantRanks: []int{1, 2},
+		},
+		{
+			name: "a failing condition should cancel every action",
+			build: func(tw *TransactWriter) {
+				tw.Put(testTaskTable, testTask{ID: "new"}).
+					Delete(testTaskTable, key("old")).
+					ConditionCheck(testRankTable, map[string]interface{}{"Group": "g", "Rank": 3}, name("Rank").AttributeExists())
+			},
+			wantErr: ErrTransactionCanceled,
+		},
+		{
+			name: "conditions on one action should be combined",
+			build: func(tw *TransactWriter) {
+				tw.Delete(testTaskTable, key("old"), name("Amount").Equal(value(1)), name("TaskName").Equal(value("other")))
+			},
+			wantErr: ErrConditionFailed,
+		},
+		{
+			name: "sending the same token twice should write once",
+			build: func(tw *TransactWriter) {
+				tw.Token("same-token").Update(testTaskTable, key("counter"), expression.Add(name("Amount"), value(1)))
+			},
+			twice: true,
+			wantTasks: []testTask{
+				{ID: "counter", Group: "c", TaskName: "counter", Amount: 6, Tags: []string{"a", "b"}},
+				{ID: "old", TaskName: "old", Amount: 1},
+			},
+			wantRanks: []int{2},
+		},
+		{
+			name:    "an empty transaction should not be sent",
+			build:   func(tw *TransactWriter) {},
+			wantErr: ErrValidation,
+		},
+		{
+			name: "more than 100 actions should not be sent",
+			build: func(tw *TransactWriter) {
+				for _, id := range batchIDs(101) {
+					tw.Put(testTaskTable, testTask{ID: id})
+				}
+			},
+			wantErr: ErrValidation,
+		},
+		{
+			name: "more than 4 MB should not be sent",
+			build: func(tw *TransactWriter) {
+				for _, id := range batchIDs(11) {
+					tw.Put(testTaskTable, bigTask(id, 390<<10))
+				}
+			},
+			wantErr: ErrValidation,
+		},
+		{
+			name: "an oversized item should not be sent",
+			build: func(tw *TransactWriter) {
+				tw.Put(testTaskTable, testTask{ID: "new"}).Put(testTaskTable, bigTask("big", 401<<10))
+			},
+			wantErr: ErrItemTooLarge,
+		},
+		{
+			name: "an item that cannot be marshaled should not be sent",
+			build: func(tw *TransactWriter) {
+				tw.Put(testTaskTable, testTask{ID: "new"}).Put(testTaskTable, map[string]interface{}{"ID": "bad", "Bad": badAttribute{}})
+			},
+			wantErr: errBadAttribute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			seedTasks(t, sess,
+				testTask{ID: "old", TaskName: "old", Amount: 1},
+				testTask{ID: "counter", Group: "c", TaskName: "counter", Amount: 5, Tags: []string{"a", "b"}},
+			)
+			if err := NewWorker(sess, testRankTable).Save(testTask{Group: "g", Rank: 2}); err != nil {
+				t.Fatal(err)
+			}
+
+			var err error
+			for i := 0; i < 1 || tt.twice && i < 2; i++ {
+				tw := NewWorker(sess, testTaskTable).TransactWriter()
+				tt.build(tw)
+				if err = tw.Write(); err != nil {
+					break
+				}
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("TransactWriter.Write() error = %v, want %v", err, tt.wantErr)
+				}
+				tt.wantTasks = []testTask{
+					{ID: "counter", Group: "c", TaskName: "counter", Amount: 5, Tags: []string{"a", "b"}},
+					{ID: "old", TaskName: "old", Amount: 1},
+				}
+				tt.wantRanks = []int{2}
+			} else if err != nil {
+				t.Fatalf("TransactWriter.Write() error = %v", err)
+			}
+
+			var tasks, ranked []testTask
+			if _, err := NewWorker(sess, testTaskTable).Scan(&tasks); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewWorker(sess, testRankTable).Scan(&ranked); err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+			for i := range tasks {
+				sort.Strings(tasks[i].Tags)
+			}
+			if !reflect.DeepEqual(tasks, tt.wantTasks) {
+				t.Errorf("%s after TransactWriter.Write() = %+v, want %+v", testTaskTable, tasks, tt.wantTasks)
+			}
+			ranks := make([]int, len(ranked))
+			for i, task := range ranked {
+				ranks[i] = task.Rank
+			}
+			sort.Ints(ranks)
+			if !reflect.DeepEqual(ranks, tt.wantRanks) {
+				t.Errorf("%s ranks after TransactWriter.Write() = %v, want %v", testRankTable, ranks, tt.wantRanks)
+			}
+		})
+	}
+}
+
+func TestTransactWriter_Failures(t *testing.T) {
+	name := expression.Name
+	value := expression.Value
+	key := func(id string) map[string]interface{} { return map[string]interface{}{"ID": id} }
+	avKey := func(id string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"ID": {S: aws.String(id)}}
+	}
+	oldItem := map[string]*dynamodb.AttributeValue{
+		"ID":       {S: aws.String("old")},
+		"TaskName": {S: aws.String("old")},
+		"Amount":   {N: aws.String("1")},
+	}
+
+	tests := []struct {
+		name  string
+		build func(tw *TransactWriter)
+		want  []TransactionFailure
+	}{
+		{
+			name: "a failing update should be reported at its index with its key",
+			build: func(tw *TransactWriter) {
+				tw.Put(testTaskTable, testTask{ID: "new"}).
+					Update(testTaskTable, key("old"), expression.Add(name("Amount"), value(1)), name("Amount").GreaterThan(value(1)))
+			},
+			want: []TransactionFailure{
+				{Index: 1, Table: testTaskTable, Key: avKey("old"), Code: "ConditionalCheckFailed", Message: "The conditional request failed"},
+			},
+		},
+		{
+			name: "old items should be reported when asked for",
+			build: func(tw *TransactWriter) {
+				tw.ReturnOldItems().
+					Put(testTaskTable, testTask{ID: "new"}).
+					ConditionCheck(testTaskTable, key("old"), name("Amount").GreaterThan(value(1))).
+					ConditionCheck(testRankTable, map[string]interface{}{"Group": "g", "Rank": 2}, name("Rank").AttributeExists())
+			},
+			want: []TransactionFailure{
+				{Index: 1, Table: testTaskTable, Key: avKey("old"), Code: "ConditionalCheckFailed", Message: "The conditional request failed", OldItem: oldItem},
+				{
+					Index:   2,
+					Table:   testRankTable,
+					Key:     map[string]*dynamodb.AttributeValue{"Group": {S: aws.String("g")}, "Rank": {N: aws.String("2")}},
+					Code:    "ConditionalCheckFailed",
+					Message: "The conditional request failed",
+				},
+			},
+		},
+		{
+			name: "a failing put should be reported with its item",
+			build: func(tw *TransactWriter) {
+				tw.Delete(testTaskTable, key("other")).
+					Put(testTaskTable, testTask{ID: "old", TaskName: "again"}, name("ID").AttributeNotExists())
+			},
+			want: []TransactionFailure{
+				{
+					Index:   1,
+					Table:   testTaskTable,
+					Key:     map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("old")}, "TaskName": {S: aws.String("again")}},
+					Code:    "ConditionalCheckFailed",
+					Message: "The conditional request failed",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			seedTasks(t, sess, testTask{ID: "old", TaskName: "old", Amount: 1})
+
+			tw := NewWorker(sess, testTaskTable).TransactWriter()
+			tt.build(tw)
+			err := tw.Write()
+
+			var txErr *TransactionError
+			if !errors.As(err, &txErr) {
+				t.Fatalf("TransactWriter.Write() error = %v, want *TransactionError", err)
+			}
+			if !errors.Is(err, ErrTransactionCanceled) || !errors.Is(err, ErrConditionFailed) {
+				t.Errorf("TransactWriter.Write() error = %v, want a canceled transaction with a failed condition", err)
+			}
+			if !reflect.DeepEqual(txErr.Failures, tt.want) {
+				t.Errorf("TransactWriter.Write() failures = %+v, want %+v", txErr.Failures, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransactionError(t *testing.T) {
+	canceled := func(codes ...string) error {
+		reasons := make([]*dynamodb.CancellationReason, len(codes))
+		for i, code := range codes {
+			reasons[i] = &dynamodb.CancellationReason{Code: aws.String(code)}
+		}
+		return classifyError(&dynamodb.TransactionCanceledException{Message_: aws.String("Transaction cancelled"), CancellationReasons: reasons})
+	}
+	targets := []transactTarget{
+		{table: testTaskTable, key: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("1")}}},
+		{table: testTaskTable, key: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("2")}}},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want []TransactionFailure
+	}{
+		{
+			name: "reasons of every action should map to failures",
+			err:  canceled("None", "ConditionalCheckFailed"),
+			want: []TransactionFailure{{Index: 1, Table: testTaskTable, Key: targets[1].key, Code: "ConditionalCheckFailed"}},
+		},
+		{
+			name: "reasons that do not match the actions should leave no failures",
+			err:  canceled("ConditionalCheckFailed"),
+		},
+		{
+			name: "a cancellation without reasons should leave no failures",
+			err:  classifyError(awserr.New(dynamodb.ErrCodeTransactionCanceledException, "Transaction cancelled", nil)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := transactionError(tt.err, targets)
+
+			var txErr *TransactionError
+			if !errors.As(err, &txErr) {
+				t.Fatalf("transactionError() = %v, want *TransactionError", err)
+			}
+			if !errors.Is(err, ErrTransactionCanceled) {
+				t.Errorf("transactionError() = %v, want a canceled transaction", err)
+			}
+			if !reflect.DeepEqual(txErr.Failures, tt.want) {
+				t.Errorf("transactionError() failures = %+v, want %+v", txErr.Failures, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransactRetry_retryable(t *testing.T) {
+	canceled := func(codes ...string) error {
+		reasons := make([]*dynamodb.CancellationReason, len(codes))
+		for i, code := range codes {
+			reasons[i] = &dynamodb.CancellationReason{Code: aws.String(code)}
+		}
+		err := classifyError(&dynamodb.TransactionCanceledException{Message_: aws.String("Transaction cancelled"), CancellationReasons: reasons})
+		return errors.Wrap(err, "transaction failed")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "conflicts should be retried",
+			err:  canceled("None", "TransactionConflict", "None"),
+			want: true,
+		},
+		{
+			name: "throttled actions should be retried",
+			err:  canceled("ThrottlingError", "TransactionConflict"),
+			want: true,
+		},
+		{
+			name: "a failed condition should not be retried along with a conflict",
+			err:  canceled("TransactionConflict", "ConditionalCheckFailed"),
+			want: false,
+		},
+		{
+			name: "a cancellation without reasons should not be retried",
+			err:  classifyError(awserr.New(dynamodb.ErrCodeTransactionCanceledException, "Transaction cancelled", nil)),
+			want: false,
+		},
+		{
+			name: "a transaction in progress should be retried",
+			err:  awserr.New(dynamodb.ErrCodeTransactionInProgressException, "Transaction is in progress", nil),
+			want: true,
+		},
+		{
+			name: "other errors should not be retried",
+			err:  classifyError(awserr.New("ValidationException", "Transaction request cannot include multiple operations on one item", nil)),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultTransactRetry.retryable(tt.err); got != tt.want {
+				t.Errorf("TransactRetry.retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransactWriter_Retry(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	db.TransactionDelay = 100 * time.Millisecond
+	seedTasks(t, sess, testTask{ID: "1"}, testTask{ID: "2"})
+
+	retry := TransactRetry{
+		MaxAttempts: 20,
+		Backoff:     Backoff{Base: 25 * time.Millisecond, Max: 100 * time.Millisecond},
+		Reasons:     []string{"TransactionConflict"},
+	}
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			errs <- NewWorker(sess, testTaskTable).TransactWriter().Retry(retry).
+				Update(testTaskTable, map[string]interface{}{"ID": "1"}, expression.Add(expression.Name("Amount"), expression.Value(1))).
+				Update(testTaskTable, map[string]interface{}{"ID": "2"}, expression.Add(expression.Name("Amount"), expression.Value(1))).
+				Write()
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("TransactWriter.Write() error = %v", err)
+		}
+	}
+
+	var tasks []testTask
+	if _, err := NewWorker(sess, testTaskTable).Scan(&tasks); err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range tasks {
+		if task.Amount != 3 {
+			t.Errorf("Amount of %s after three retried transactions = %d, want 3", task.ID, task.Amount)
+		}
+	}
+}
+
+func TestWorker_TransactGet(t *testing.T) {
+	key := func(id string) map[string]interface{} { return map[string]interface{}{"ID": id} }
+
+	tests := []struct {
+		name         string
+		gets         func() []TransactGet
+		busy         bool
+		wantErr      error
+		wantItems    []testTask
+		wantNotFound []bool
+	}{
+		{
+			name: "items across tables should be read into their destinations",
+			gets: func() []TransactGet {
+				return []TransactGet{
+					{Table: testTaskTable, Key: key("1"), Dst: &testTask{}},
+					{Table: testTaskTable, Key: key("missing"), Dst: &testTask{}},
+					{Table: testRankTable, Key: map[string]interface{}{"Group": "g", "Rank": 2}, Dst: &testTask{}},
+					{Table: testTaskTable, Key: key("2"), Projection: []string{"ID", "Amount"}, Dst: &testTask{}},
+				}
+			},
+			wantItems: []testTask{
+				{ID: "1", TaskName: "first", Amount: 1},
+				{},
+				{Group: "g", Rank: 2, TaskName: "ranked"},
+				{ID: "2", Amount: 2},
+			},
+			wantNotFound: []bool{false, true, false, false},
+		},
+		{
+			name:    "no gets should read nothing",
+			gets:    func() []TransactGet { return nil },
+			wantErr: nil,
+		},
+		{
+			name: "more than 100 gets should not be sent",
+			gets: func() []TransactGet {
+				var gets []TransactGet
+				for _, id := range batchIDs(101) {
+					gets = append(gets, TransactGet{Table: testTaskTable, Key: key(id), Dst: &testTask{}})
+				}
+				return gets
+			},
+			wantErr: ErrValidation,
+		},
+		{
+			name: "reading an item twice should be a validation failure",
+			gets: func() []TransactGet {
+				return []TransactGet{
+					{Table: testTaskTable, Key: key("1"), Dst: &testTask{}},
+					{Table: testTaskTable, Key: key("1"), Dst: &testTask{}},
+				}
+			},
+			wantErr: ErrValidation,
+		},
+		{
+			name: "items held by a transaction should be a conflict",
+			gets: func() []TransactGet {
+				return []TransactGet{
+					{Table: testTaskTable, Key: key("1"), Dst: &testTask{}},
+					{Table: testTaskTable, Key: key("2"), Dst: &testTask{}},
+				}
+			},
+			busy:    true,
+			wantErr: ErrTransactionCanceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sess := setupMemoryDB(t)
+			seedTasks(t, sess, testTask{ID: "1", TaskName: "first", Amount: 1}, testTask{ID: "2", TaskName: "second", Amount: 2})
+			if err := NewWorker(sess, testRankTable).Save(testTask{Group: "g", Rank: 2, TaskName: "ranked"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.busy {
+				db.TransactionDelay = 200 * time.Millisecond
+				done := make(chan error, 1)
+				go func() {
+					done <- NewWorker(sess, testTaskTable).TransactWriter().
+						Update(testTaskTable, key("2"), expression.Add(expression.Name("Amount"), expression.Value(1))).
+						Write()
+				}()
+				defer func() {
+					if err := <-done; err != nil {
+						t.Error(err)
+					}
+				}()
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			gets := tt.gets()
+			err := NewWorker(sess, testTaskTable).TransactGet(gets)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Worker.TransactGet() error = %v, want %v", err, tt.wantErr)
+				}
+				var txErr *TransactionError
+				if tt.busy && (!errors.As(err, &txErr) || len(txErr.Failures) != 1 || txErr.Failures[0].Index != 1 || txErr.Failures[0].Code != "TransactionConflict") {
+					t.Errorf("Worker.TransactGet() error = %v, want a TransactionConflict on get 1", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Worker.TransactGet() error = %v", err)
+			}
+
+			for i, g := range gets {
+				if got := *g.Dst.(*testTask); !reflect.DeepEqual(got, tt.wantItems[i]) {
+					t.Errorf("Worker.TransactGet() item %d = %+v, want %+v", i, got, tt.wantItems[i])
+				}
+				if g.NotFound != tt.wantNotFound[i] {
+					t.Errorf("Worker.TransactGet() NotFound %d = %v, want %v", i, g.NotFound, tt.wantNotFound[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWorker_BatchGetKeys(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	db.MaxBatchGets = 30
+
+	var items []interface{}
+	for i := 1; i <= 250; i++ {
+		items = append(items, testTask{Group: "g", Rank: i})
+	}
+	if err := NewWorker(sess, testRankTable).BatchSave(items); err != nil {
+		t.Fatal(err)
+	}
+
+	rankKey := func(rank int) map[string]interface{} {
+		return map[string]interface{}{"Group": "g", "Rank": rank}
+	}
+
+	tests := []struct {
+		name        string
+		ordered     bool
+		keys        []map[string]interface{}
+		wantRanks   []int
+		wantMissing []map[string]interface{}
+	}{
+		{
+			name:      "keys over several chunks should all be read",
+			keys:      rankKeys(rankKey, 1, 251),
+			wantRanks: ranks(1, 251),
+		},
+		{
+			name:        "ordered read should follow the keys and report missing ones",
+			ordered:     true,
+			keys:        []map[string]interface{}{rankKey(7), rankKey(300), rankKey(3), rankKey(7), rankKey(-1)},
+			wantRanks:   []int{7, 3, 7},
+			wantMissing: []map[string]interface{}{rankKey(300), rankKey(-1)},
+		},
+		{
+			name: "no keys should read nothing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorker(sess, testRankTable).Ordered(tt.ordered).Concurrency(2).Backoff(Backoff{Base: time.Millisecond, Max: time.Millisecond})
+
+			var got []testTask
+			missing, err := w.BatchGetKeys(tt.keys, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotRanks := make([]int, len(got))
+			for i, task := range got {
+				gotRanks[i] = task.Rank
+			}
+			if !tt.ordered {
+				sort.Ints(gotRanks)
+			}
+			if len(gotRanks) != len(tt.wantRanks) || len(gotRanks) > 0 && !reflect.DeepEqual(gotRanks, tt.wantRanks) {
+				t.Errorf("Worker.BatchGetKeys() ranks = %v, want %v", gotRanks, tt.wantRanks)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("Worker.BatchGetKeys() missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestWorker_BatchGetKeys_Canceled(t *testing.T) {
+	_, sess := setupMemoryDB(t)
+	seedTasks(t, sess, testTask{ID: "a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var got []testTask
+	missing, err := NewWorker(sess, testTaskTable).Context(ctx).BatchGetKeys([]map[string]interface{}{{"ID": "a"}}, &got)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Worker.BatchGetKeys() error = %v, want %v", err, context.Canceled)
+	}
+	if len(missing) > 0 {
+		t.Errorf("Worker.BatchGetKeys() missing = %v, want none with an error", missing)
+	}
+}
+
+func TestWorker_Read_Canceled(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(w *Worker) error
+	}{
+		{
+			name: "Get",
+			read: func(w *Worker) error {
+				var got testTask
+				return w.Key("ID", "a").Get(&got)
+			},
+		},
+		{
+			name: "Query",
+			read: func(w *Worker) error {
+				var got []testTask
+				_, err := w.Key("ID", "a").Query(&got)
+				return err
+			},
+		},
+		{
+			name: "Scan",
+			read: func(w *Worker) error {
+				var got []testTask
+				_, err := w.Scan(&got)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, sess := setupMemoryDB(t)
+			seedTasks(t, sess, testTask{ID: "a"})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := tt.read(NewWorker(sess, testTaskTable).Context(ctx))
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Worker.%s() error = %v, want %v", tt.name, err, context.Canceled)
+			}
+		})
+	}
+}
+
+func TestWorker_BatchGet(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	db.MaxBatchGets = 30
+	if err := NewWorker(sess, testTaskTable).BatchSave(batchTasks(150)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []testTask
+	if err := NewWorker(sess, testTaskTable).Ordered(true).BatchGet("ID", batchIDs(160), &got); err != nil {
+		t.Fatal(err)
+	}
+	if ids := taskIDs(got); !reflect.DeepEqual(ids, batchIDs(150)) {
+		t.Errorf("Worker.BatchGet() = %v, want %v", ids, batchIDs(150))
+	}
+}
+
+func TestWorker_Transacte(t *testing.T) {
+	db, sess := setupMemoryDB(t)
+	seedTasks(t, sess, testTask{ID: "0"}, testTask{ID: "1"}, testTask{ID: "2"})
+
+	tests := []struct {
+		name    string
+		delay   bool
+		retry   bool
+		wantErr bool
+	}{
+		{
+			name:    "if the transaction has no conflict, should return success",
+			wantErr: false,
+		},
+		{
+			name:    "if another transaction holds the items, should return error(TransactionConflict)",
+			delay:   true,
+			wantErr: true,
+		},
+		{
+			name:    "if another transaction holds the items and conflicts are retried, should return success",
+			delay:   true,
+			retry:   true,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := generateSuccessCase(generateWorkers(sess, 3))
+			if !tt.delay {
+				if err := NewTransaction(sess, items).Transacte(); (err != nil) != tt.wantErr {
+					t.Errorf("Transaction.Transacte() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			db.TransactionDelay = 200 * time.Millisecond
+			defer func() { db.TransactionDelay = 0 }()
+
+			tr := NewTransaction(sess, items)
+			if tt.retry {
+				tr = tr.Retry(TransactRetry{
+					MaxAttempts: 20,
+					Backoff:     Backoff{Base: 50 * time.Millisecond, Max: 200 * time.Millisecond},
+					Reasons:     []string{"TransactionConflict"},
+				})
+			}
+			errs := make(chan error, 2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					errs <- tr.Transacte()
+				}()
+			}
+			failed := 0
+			for i := 0; i < 2; i++ {
+				if err := <-errs; err != nil {
+					failed++
+					var txErr *TransactionError
+					if !errors.As(err, &txErr) || len(txErr.Failures) != len(items) || txErr.Failures[0].Code != "TransactionConflict" {
+						t.Errorf("Transaction.Transacte() error = %v, want a TransactionConflict on every item", err)
+					}
+				}
+			}
+			if (failed > 0) != tt.wantErr {
+				t.Errorf("concurrent Transaction.Transacte() failed %d times, wantErr %v", failed, tt.wantErr)
+			}
+		})
+	}
+
+	var got testTask
+	if err := NewWorker(sess, testTaskTable).Key("ID", "1").ConsistentRead(true).Get(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Amount != 8 {
+		t.Errorf("Amount after four successful transactions = %d, want 8", got.Amount)
+	}
+}
+
+func rankKeys(key func(int) map[string]interface{}, from, to int) []map[string]interface{} {
+	keys := make([]map[string]interface{}, 0, to-from)
+	for i := from; i < to; i++ {
+		keys = append(keys, key(i))
+	}
+	return keys
+}
+
+func ranks(from, to int) []int {
+	r := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		r = append(r, i)
+	}
+	return r
+}
+
+type badAttribute struct{}
+
+var errBadAttribute = errors.New("bad attribute")
+
+func (badAttribute) MarshalDynamoDBAttributeValue(*dynamodb.AttributeValue) error {
+	return errBadAttribute
+}
+
+func batchIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	return ids
+}
+
+func batchTasks(n int) []interface{} {
+	items := make([]interface{}, n)
+	for i, id := range batchIDs(n) {
+		items[i] = testTask{ID: id}
+	}
+	return items
+}
+
+func taskIDs(tasks []testTask) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		attempt int
+		wantMax time.Duration
+	}{
+		{
+			name:    "a step below Max should be at most Base doubled per attempt",
+			backoff: Backoff{Base: 10 * time.Millisecond, Max: time.Second},
+			attempt: 2,
+			wantMax: 40 * time.Millisecond,
+		},
+		{
+			name:    "a step beyond Max should be at most Max",
+			backoff: Backoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond},
+			attempt: 10,
+			wantMax: 50 * time.Millisecond,
+		},
+		{
+			name:    "only Base set should grow from Base",
+			backoff: Backoff{Base: 10 * time.Millisecond},
+			attempt: 1,
+			wantMax: 20 * time.Millisecond,
+		},
+		{
+			name:    "only Base set should be capped by the default Max",
+			backoff: Backoff{Base: 10 * time.Millisecond},
+			attempt: 20,
+			wantMax: DefaultBackoff.Max,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var longest time.Duration
+			for i := 0; i < 100; i++ {
+				d := tt.backoff.Delay(tt.attempt)
+				if d < 0 || d > tt.wantMax {
+					t.Fatalf("Backoff.Delay(%d) = %v, want within [0, %v]", tt.attempt, d, tt.wantMax)
+				}
+				if d > longest {
+					longest = d
+				}
+			}
+			if longest == 0 {
+				t.Errorf("Backoff.Delay(%d) = 0 in every try, want a delay up to %v", tt.attempt, tt.wantMax)
+			}
+		})
+	}
+}